@@ -0,0 +1,314 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"micro/loadbalance"
+	"sync"
+	"time"
+)
+
+// ErrOpen 熔断器打开，或半开状态下试探的请求数已满
+var ErrOpen = errors.New("micro: 熔断器已打开")
+
+type State int
+
+const (
+	// StateClosed 正常放行，统计错误率和慢调用比例
+	StateClosed State = iota
+	// StateOpen 拒绝所有请求，OpenTimeout后进入半开
+	StateOpen
+	// StateHalfOpen 放行少量请求试探，全部成功则关闭，任意失败则重新打开
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker 一个调用目标的熔断器
+type Breaker struct {
+	name string
+
+	window           time.Duration
+	buckets          int
+	minRequests      int
+	errorRate        float64
+	slowCall         time.Duration
+	slowCallRate     float64
+	openTimeout      time.Duration
+	halfOpenRequests int
+	isFailure        func(err error) bool
+	onStateChange    func(name string, from, to State)
+	now              func() time.Time
+
+	mutex  sync.Mutex
+	state  State
+	counts []bucket
+	// cursor 当前桶的下标，cursorAt 当前桶的开始时间
+	cursor   int
+	cursorAt time.Time
+	openedAt time.Time
+	// probes 半开状态下已放行的请求数，passed 其中已经成功的请求数
+	probes int
+	passed int
+}
+
+type bucket struct {
+	total    int
+	failures int
+	slow     int
+}
+
+type BreakerOption func(b *Breaker)
+
+// BreakerWithWindow 滑动窗口的长度和桶数，默认10s、10个桶
+func BreakerWithWindow(window time.Duration, buckets int) BreakerOption {
+	return func(b *Breaker) {
+		b.window = window
+		b.buckets = buckets
+	}
+}
+
+// BreakerWithMinRequests 窗口内请求数达到该值才会计算比例，默认20
+func BreakerWithMinRequests(n int) BreakerOption {
+	return func(b *Breaker) {
+		b.minRequests = n
+	}
+}
+
+// BreakerWithErrorRate 错误率达到该值时打开，默认0.5，<=0 表示不按错误率熔断
+func BreakerWithErrorRate(rate float64) BreakerOption {
+	return func(b *Breaker) {
+		b.errorRate = rate
+	}
+}
+
+// BreakerWithSlowCall 耗时超过threshold为慢调用，慢调用比例达到rate时打开，默认不按慢调用熔断
+func BreakerWithSlowCall(threshold time.Duration, rate float64) BreakerOption {
+	return func(b *Breaker) {
+		b.slowCall = threshold
+		b.slowCallRate = rate
+	}
+}
+
+// BreakerWithOpenTimeout 打开后经过该时间进入半开，默认5s
+func BreakerWithOpenTimeout(timeout time.Duration) BreakerOption {
+	return func(b *Breaker) {
+		b.openTimeout = timeout
+	}
+}
+
+// BreakerWithHalfOpenRequests 半开状态下放行的试探请求数，默认3
+func BreakerWithHalfOpenRequests(n int) BreakerOption {
+	return func(b *Breaker) {
+		b.halfOpenRequests = n
+	}
+}
+
+// BreakerWithIsFailure 判断错误是否计入失败，默认见 IsFailure
+func BreakerWithIsFailure(fn func(err error) bool) BreakerOption {
+	return func(b *Breaker) {
+		b.isFailure = fn
+	}
+}
+
+// BreakerWithOnStateChange 状态变化时回调，用于打日志或上报指标，回调时持有锁，不要阻塞
+func BreakerWithOnStateChange(fn func(name string, from, to State)) BreakerOption {
+	return func(b *Breaker) {
+		b.onStateChange = fn
+	}
+}
+
+// IsFailure 见 loadbalance.IsFailure
+func IsFailure(err error) bool {
+	return loadbalance.IsFailure(err)
+}
+
+func NewBreaker(name string, opts ...BreakerOption) *Breaker {
+	res := &Breaker{
+		name:             name,
+		window:           10 * time.Second,
+		buckets:          10,
+		minRequests:      20,
+		errorRate:        0.5,
+		openTimeout:      5 * time.Second,
+		halfOpenRequests: 3,
+		isFailure:        IsFailure,
+		now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if res.buckets <= 0 {
+		res.buckets = 1
+	}
+	if res.halfOpenRequests <= 0 {
+		res.halfOpenRequests = 1
+	}
+	res.counts = make([]bucket, res.buckets)
+	res.cursorAt = res.now()
+	return res
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refresh(b.now())
+	return b.state
+}
+
+// Ready 是否可以放行请求，不占用半开状态的试探名额
+func (b *Breaker) Ready() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refresh(b.now())
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return b.probes < b.halfOpenRequests
+	default:
+		return true
+	}
+}
+
+// Allow 放行时返回调用结束后必须调用的done，熔断时返回 ErrOpen
+func (b *Breaker) Allow() (done func(err error), err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	b.refresh(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.halfOpenRequests {
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	state := b.state
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			b.done(state, now, err)
+		})
+	}, nil
+}
+
+func (b *Breaker) done(state State, start time.Time, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	b.refresh(now)
+	// 请求开始后状态已经变化，结果不再有意义
+	if b.state != state {
+		return
+	}
+
+	failure := b.isFailure(err)
+	slow := b.slowCall > 0 && now.Sub(start) >= b.slowCall
+	if b.state == StateHalfOpen {
+		if failure || slow {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.passed++
+		if b.passed >= b.halfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+		return
+	}
+
+	cur := &b.counts[b.cursor]
+	cur.total++
+	if failure {
+		cur.failures++
+	}
+	if slow {
+		cur.slow++
+	}
+	if b.shouldOpen() {
+		b.setState(StateOpen, now)
+	}
+}
+
+func (b *Breaker) shouldOpen() bool {
+	var sum bucket
+	for _, c := range b.counts {
+		sum.total += c.total
+		sum.failures += c.failures
+		sum.slow += c.slow
+	}
+	if sum.total == 0 || sum.total < b.minRequests {
+		return false
+	}
+	if b.errorRate > 0 && float64(sum.failures)/float64(sum.total) >= b.errorRate {
+		return true
+	}
+	return b.slowCallRate > 0 && float64(sum.slow)/float64(sum.total) >= b.slowCallRate
+}
+
+// refresh 滑动窗口前进，打开超时后进入半开
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == StateOpen {
+		if now.Sub(b.openedAt) >= b.openTimeout {
+			b.setState(StateHalfOpen, now)
+		}
+		return
+	}
+
+	size := b.window / time.Duration(b.buckets)
+	if size <= 0 {
+		return
+	}
+	elapsed := int(now.Sub(b.cursorAt) / size)
+	if elapsed <= 0 {
+		return
+	}
+	if elapsed > b.buckets {
+		elapsed = b.buckets
+	}
+	for i := 0; i < elapsed; i++ {
+		b.cursor = (b.cursor + 1) % b.buckets
+		b.counts[b.cursor] = bucket{}
+	}
+	b.cursorAt = b.cursorAt.Add(now.Sub(b.cursorAt) / size * size)
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	b.probes = 0
+	b.passed = 0
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		// 重新开始统计
+		for i := range b.counts {
+			b.counts[i] = bucket{}
+		}
+		b.cursorAt = now
+	}
+	if b.onStateChange != nil {
+		b.onStateChange(b.name, from, state)
+	}
+}
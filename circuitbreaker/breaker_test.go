@@ -0,0 +1,196 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestBreaker(c *clock, opts ...BreakerOption) *Breaker {
+	b := NewBreaker("test", append([]BreakerOption{
+		BreakerWithWindow(10*time.Second, 10),
+		BreakerWithMinRequests(4),
+		BreakerWithOpenTimeout(5 * time.Second),
+		BreakerWithHalfOpenRequests(2),
+	}, opts...)...)
+	b.now = c.Now
+	b.cursorAt = c.now
+	return b
+}
+
+func call(t *testing.T, b *Breaker, err error) {
+	done, allowErr := b.Allow()
+	require.NoError(t, allowErr)
+	done(err)
+}
+
+func TestBreaker_ErrorRate(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	var changes []string
+	b := newTestBreaker(c, BreakerWithOnStateChange(func(name string, from, to State) {
+		changes = append(changes, from.String()+"->"+to.String())
+	}))
+	failure := status.Error(codes.Unavailable, "unavailable")
+
+	call(t, b, nil)
+	call(t, b, failure)
+	// 调用方的错误不计入失败
+	call(t, b, status.Error(codes.InvalidArgument, "bad request"))
+	assert.Equal(t, StateClosed, b.State())
+	// 4个请求2个失败，达到0.5
+	call(t, b, failure)
+	assert.Equal(t, StateOpen, b.State())
+	_, err := b.Allow()
+	assert.Equal(t, ErrOpen, err)
+	assert.False(t, b.Ready())
+
+	// 半开，只放行两个试探请求
+	c.now = c.now.Add(5 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done1, err := b.Allow()
+	require.NoError(t, err)
+	done2, err := b.Allow()
+	require.NoError(t, err)
+	_, err = b.Allow()
+	assert.Equal(t, ErrOpen, err)
+	assert.False(t, b.Ready())
+	done1(nil)
+	// 重复调用done没有影响
+	done1(nil)
+	assert.Equal(t, StateHalfOpen, b.State())
+	done2(nil)
+	assert.Equal(t, StateClosed, b.State())
+
+	// 关闭后重新统计
+	call(t, b, failure)
+	call(t, b, failure)
+	assert.Equal(t, StateClosed, b.State())
+	call(t, b, failure)
+	call(t, b, failure)
+	assert.Equal(t, StateOpen, b.State())
+
+	// 试探失败重新打开
+	c.now = c.now.Add(5 * time.Second)
+	call(t, b, failure)
+	assert.Equal(t, StateOpen, b.State())
+
+	assert.Equal(t, []string{
+		"closed->open", "open->half-open", "half-open->closed",
+		"closed->open", "open->half-open", "half-open->open",
+	}, changes)
+}
+
+func TestBreaker_SlidingWindow(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	b := newTestBreaker(c)
+	failure := errors.New("failure")
+
+	call(t, b, failure)
+	call(t, b, failure)
+	call(t, b, nil)
+	// 旧的失败滑出窗口
+	c.now = c.now.Add(10 * time.Second)
+	call(t, b, nil)
+	call(t, b, nil)
+	call(t, b, failure)
+	call(t, b, nil)
+	assert.Equal(t, StateClosed, b.State())
+
+	// 窗口内失败 1+2 / 4+2
+	c.now = c.now.Add(5 * time.Second)
+	call(t, b, failure)
+	call(t, b, failure)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestBreaker_SlowCall(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	b := newTestBreaker(c, BreakerWithErrorRate(0), BreakerWithSlowCall(time.Second, 0.5))
+
+	slow := func() {
+		done, err := b.Allow()
+		require.NoError(t, err)
+		c.now = c.now.Add(2 * time.Second)
+		done(nil)
+	}
+	call(t, b, nil)
+	call(t, b, errors.New("failure"))
+	slow()
+	assert.Equal(t, StateClosed, b.State())
+	slow()
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestGroup_ClientMiddleware(t *testing.T) {
+	g := NewGroup(GroupWithBreakerOptions(BreakerWithMinRequests(2), BreakerWithOpenTimeout(time.Minute)))
+	cc1, err := grpc.Dial("127.0.0.1:8081", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc1.Close()
+	cc2, err := grpc.Dial("127.0.0.1:8082", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc2.Close()
+
+	var calls int
+	handler := g.ClientMiddleware()(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		if cc == cc1 && method == "/users.UserService/GetByID" {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		err = handler(context.Background(), "/users.UserService/GetByID", nil, nil, cc1)
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+	}
+	assert.Equal(t, StateOpen, g.Get("/users.UserService/GetByID", "127.0.0.1:8081").State())
+
+	// 打开后不再调用下游
+	err = handler(context.Background(), "/users.UserService/GetByID", nil, nil, cc1)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 2, calls)
+
+	// 其他方法、其他节点不受影响
+	assert.NoError(t, handler(context.Background(), "/users.UserService/Delete", nil, nil, cc1))
+	assert.NoError(t, handler(context.Background(), "/users.UserService/GetByID", nil, nil, cc2))
+}
+
+func TestGroup_IdleTimeout(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	g := NewGroup(GroupWithIdleTimeout(time.Minute))
+	g.now = c.Now
+	g.sweptAt = c.now.UnixNano()
+
+	old := g.Get("/users.UserService/GetByID", "10.0.0.1:8080")
+	c.now = c.now.Add(40 * time.Second)
+	g.Get("/users.UserService/GetByID", "10.0.0.2:8080")
+	c.now = c.now.Add(30 * time.Second)
+	// 10.0.0.1 已经下线，超过一分钟没有使用，清理；10.0.0.2 保留
+	g.Get("/users.UserService/GetByID", "10.0.0.3:8080")
+	assert.Len(t, g.breakers, 2)
+	assert.NotContains(t, g.breakers, Key("/users.UserService/GetByID", "10.0.0.1:8080"))
+	assert.Contains(t, g.breakers, Key("/users.UserService/GetByID", "10.0.0.2:8080"))
+	// 重新出现时创建新的熔断器
+	assert.NotSame(t, old, g.Get("/users.UserService/GetByID", "10.0.0.1:8080"))
+
+	// 持续使用的熔断器不会被清理
+	for i := 0; i < 5; i++ {
+		c.now = c.now.Add(30 * time.Second)
+		g.Get("/users.UserService/GetByID", "10.0.0.3:8080")
+	}
+	assert.Len(t, g.breakers, 1)
+}
@@ -0,0 +1,129 @@
+package circuitbreaker
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"micro/middleware"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Group 按方法和目标地址隔离的一组熔断器，共用同一套配置
+// 节点地址会随扩缩容变化，长时间没有被使用的熔断器会被清理
+type Group struct {
+	opts        []BreakerOption
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	mutex    sync.RWMutex
+	breakers map[string]*groupEntry
+	// sweptAt 上次清理的时间，UnixNano
+	sweptAt int64
+}
+
+type groupEntry struct {
+	breaker *Breaker
+	// usedAt 最后一次 Get 的时间，UnixNano
+	usedAt int64
+}
+
+type GroupOption func(g *Group)
+
+// GroupWithBreakerOptions 创建熔断器时使用的配置
+func GroupWithBreakerOptions(opts ...BreakerOption) GroupOption {
+	return func(g *Group) {
+		g.opts = append(g.opts, opts...)
+	}
+}
+
+// GroupWithIdleTimeout 熔断器超过该时间没有被使用就清理，默认10分钟，<=0 表示不清理
+func GroupWithIdleTimeout(timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		g.idleTimeout = timeout
+	}
+}
+
+func NewGroup(opts ...GroupOption) *Group {
+	res := &Group{
+		idleTimeout: 10 * time.Minute,
+		now:         time.Now,
+		breakers:    make(map[string]*groupEntry),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	res.sweptAt = res.now().UnixNano()
+	return res
+}
+
+// Key 熔断器的名字，方法为空表示该地址的所有方法
+func Key(fullMethod, target string) string {
+	return fullMethod + "@" + target
+}
+
+// Get 获取熔断器，不存在时创建
+func (g *Group) Get(fullMethod, target string) *Breaker {
+	key := Key(fullMethod, target)
+	now := g.now().UnixNano()
+	g.sweep(now)
+
+	g.mutex.RLock()
+	e, ok := g.breakers[key]
+	g.mutex.RUnlock()
+	if ok {
+		atomic.StoreInt64(&e.usedAt, now)
+		return e.breaker
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	e, ok = g.breakers[key]
+	if !ok {
+		e = &groupEntry{breaker: NewBreaker(key, g.opts...)}
+		g.breakers[key] = e
+	}
+	atomic.StoreInt64(&e.usedAt, now)
+	return e.breaker
+}
+
+// sweep 每个idleTimeout最多清理一次，已经拿到熔断器的调用不受影响
+func (g *Group) sweep(now int64) {
+	if g.idleTimeout <= 0 {
+		return
+	}
+	sweptAt := atomic.LoadInt64(&g.sweptAt)
+	if time.Duration(now-sweptAt) < g.idleTimeout || !atomic.CompareAndSwapInt64(&g.sweptAt, sweptAt, now) {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for key, e := range g.breakers {
+		if time.Duration(now-atomic.LoadInt64(&e.usedAt)) >= g.idleTimeout {
+			delete(g.breakers, key)
+		}
+	}
+}
+
+// ClientMiddleware 按方法和 cc.Target() 熔断
+// cluster/* 对每个节点单独Dial，放在它们后面时就是按节点地址熔断；
+// 通过注册中心解析的连接，节点级别的熔断由 PickerBuilder 完成
+func (g *Group) ClientMiddleware() middleware.ClientMiddleware {
+	return func(handler middleware.ClientHandler) middleware.ClientHandler {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			done, err := g.Get(method, cc.Target()).Allow()
+			if err != nil {
+				return status.Error(codes.Unavailable, err.Error())
+			}
+			err = handler(ctx, method, req, reply, cc, opts...)
+			done(err)
+			return err
+		}
+	}
+}
+
+func (g *Group) BuildUnaryInterceptor() grpc.UnaryClientInterceptor {
+	return middleware.BuildClientInterceptor([]middleware.ClientMiddleware{g.ClientMiddleware()})
+}
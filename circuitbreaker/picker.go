@@ -0,0 +1,104 @@
+package circuitbreaker
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"micro/loadbalance"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PickerBuilder 包装负载均衡的 base.PickerBuilder，熔断器打开的节点不参与负载均衡
+// 熔断器按 PickInfo.FullMethodName 和节点地址隔离，调用结果通过 PickResult.Done 记录
+// 例如 micro.ClientWithPickBuilder("breaker_round_robin", NewPickerBuilder(&round_robin.Builder{}, group))
+type PickerBuilder struct {
+	Builder base.PickerBuilder
+	Group   *Group
+}
+
+func NewPickerBuilder(builder base.PickerBuilder, group *Group) *PickerBuilder {
+	return &PickerBuilder{
+		Builder: builder,
+		Group:   group,
+	}
+}
+
+func (b *PickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	return &picker{
+		builder: b.Builder,
+		group:   b.Group,
+		info:    info,
+		pickers: make(map[string]balancer.Picker),
+	}
+}
+
+type picker struct {
+	builder base.PickerBuilder
+	group   *Group
+	info    base.PickerBuildInfo
+
+	mutex sync.Mutex
+	// pickers 以被熔断的节点集合为key缓存内部的picker，熔断状态不变时复用，保持轮询等状态
+	pickers map[string]balancer.Picker
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	if len(p.info.ReadySCs) == 0 {
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
+
+	var open []string
+	ready := make(map[balancer.SubConn]base.SubConnInfo, len(p.info.ReadySCs))
+	for conn, sci := range p.info.ReadySCs {
+		if p.group.Get(info.FullMethodName, sci.Address.Addr).Ready() {
+			ready[conn] = sci
+			continue
+		}
+		open = append(open, sci.Address.Addr)
+	}
+	if len(ready) == 0 {
+		return balancer.PickResult{}, status.Error(codes.Unavailable, ErrOpen.Error())
+	}
+
+	res, err := p.picker(open, ready).Pick(info)
+	if err != nil {
+		return res, err
+	}
+	sci, ok := ready[res.SubConn]
+	if !ok {
+		return res, nil
+	}
+	// 半开状态下试探名额可能已经被并发的请求用完
+	// 请求没有发出，内部的picker只释放活跃请求数，不能当作失败降低节点的权重
+	done, err := p.group.Get(info.FullMethodName, sci.Address.Addr).Allow()
+	if err != nil {
+		if res.Done != nil {
+			res.Done(balancer.DoneInfo{Err: loadbalance.ErrNotSent})
+		}
+		return balancer.PickResult{}, status.Error(codes.Unavailable, err.Error())
+	}
+	next := res.Done
+	res.Done = func(di balancer.DoneInfo) {
+		done(di.Err)
+		if next != nil {
+			next(di)
+		}
+	}
+	return res, nil
+}
+
+func (p *picker) picker(open []string, ready map[balancer.SubConn]base.SubConnInfo) balancer.Picker {
+	sort.Strings(open)
+	key := strings.Join(open, ",")
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	res, ok := p.pickers[key]
+	if !ok {
+		res = p.builder.Build(base.PickerBuildInfo{ReadySCs: ready})
+		p.pickers[key] = res
+	}
+	return res
+}
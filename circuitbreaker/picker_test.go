@@ -0,0 +1,126 @@
+package circuitbreaker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"micro/loadbalance"
+	"testing"
+	"time"
+)
+
+type subConn struct {
+	balancer.SubConn
+	addr string
+}
+
+// firstBuilder 总是选择地址最小的节点
+type firstBuilder struct {
+	builds int
+}
+
+func (b *firstBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	b.builds++
+	return firstPicker(info)
+}
+
+type firstPicker base.PickerBuildInfo
+
+func (p firstPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var res balancer.SubConn
+	var addr string
+	for conn, sci := range p.ReadySCs {
+		if res == nil || sci.Address.Addr < addr {
+			res, addr = conn, sci.Address.Addr
+		}
+	}
+	return balancer.PickResult{SubConn: res}, nil
+}
+
+func TestPickerBuilder(t *testing.T) {
+	g := NewGroup(GroupWithBreakerOptions(BreakerWithMinRequests(1), BreakerWithOpenTimeout(time.Minute), BreakerWithHalfOpenRequests(1)))
+	inner := &firstBuilder{}
+	conns := []*subConn{{addr: "127.0.0.1:8081"}, {addr: "127.0.0.1:8082"}}
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for _, conn := range conns {
+		info.ReadySCs[conn] = base.SubConnInfo{Address: resolver.Address{Addr: conn.addr}}
+	}
+	p := NewPickerBuilder(inner, g).Build(info)
+	getByID := balancer.PickInfo{FullMethodName: "/users.UserService/GetByID"}
+
+	res, err := p.Pick(getByID)
+	require.NoError(t, err)
+	assert.Equal(t, conns[0], res.SubConn)
+	res.Done(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "unavailable")})
+
+	// 8081的GetByID被熔断，换到8082
+	res, err = p.Pick(getByID)
+	require.NoError(t, err)
+	assert.Equal(t, conns[1], res.SubConn)
+	res.Done(balancer.DoneInfo{})
+	res, err = p.Pick(getByID)
+	require.NoError(t, err)
+	assert.Equal(t, conns[1], res.SubConn)
+	res.Done(balancer.DoneInfo{})
+	// 熔断状态不变时复用内部的picker
+	assert.Equal(t, 2, inner.builds)
+
+	// 其他方法不受影响
+	res, err = p.Pick(balancer.PickInfo{FullMethodName: "/users.UserService/Delete"})
+	require.NoError(t, err)
+	assert.Equal(t, conns[0], res.SubConn)
+
+	// 所有节点都被熔断
+	for i := 0; i < 2; i++ {
+		res, err = p.Pick(getByID)
+		require.NoError(t, err)
+		res.Done(balancer.DoneInfo{Err: status.Error(codes.Internal, "internal")})
+	}
+	_, err = p.Pick(getByID)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// probePicker 选中节点时用掉半开状态的试探名额，模拟并发的请求
+type probePicker struct {
+	conn  balancer.SubConn
+	group *Group
+	dones []balancer.DoneInfo
+}
+
+func (p *probePicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	_, _ = p.group.Get(info.FullMethodName, "127.0.0.1:8081").Allow()
+	return balancer.PickResult{
+		SubConn: p.conn,
+		Done: func(info balancer.DoneInfo) {
+			p.dones = append(p.dones, info)
+		},
+	}, nil
+}
+
+func (p *probePicker) Build(info base.PickerBuildInfo) balancer.Picker {
+	return p
+}
+
+func TestPickerBuilder_ProbeExhausted(t *testing.T) {
+	// 打开后立即进入半开，只有一个试探名额
+	g := NewGroup(GroupWithBreakerOptions(BreakerWithMinRequests(1), BreakerWithOpenTimeout(0), BreakerWithHalfOpenRequests(1)))
+	method := "/users.UserService/GetByID"
+	call(t, g.Get(method, "127.0.0.1:8081"), status.Error(codes.Unavailable, "unavailable"))
+	assert.Equal(t, StateHalfOpen, g.Get(method, "127.0.0.1:8081").State())
+
+	conn := &subConn{addr: "127.0.0.1:8081"}
+	inner := &probePicker{conn: conn, group: g}
+	p := NewPickerBuilder(inner, g).Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		conn: {Address: resolver.Address{Addr: conn.addr}},
+	}})
+	_, err := p.Pick(balancer.PickInfo{FullMethodName: method})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	// 请求没有发出，内部的picker不能记为失败
+	require.Len(t, inner.dones, 1)
+	assert.Equal(t, loadbalance.ErrNotSent, inner.dones[0].Err)
+	assert.False(t, loadbalance.IsFailure(inner.dones[0].Err))
+}
@@ -6,17 +6,38 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"micro/loadbalance/round_robin"
+	"micro/middleware"
 	"micro/registry"
+	"sync/atomic"
 	"time"
 )
 
+// defaultHealthBalancer 开启健康检查但没有指定负载均衡时使用
+const defaultHealthBalancer = "micro_health_round_robin"
+
+// balancerSeq 带hook的balancer按客户端区分名字，避免全局注册时互相覆盖
+var balancerSeq int64
+
 type Client struct {
-	insecure bool
-	registry registry.Registry
-	timeout  time.Duration
-	balancer string
+	insecure    bool
+	registry    registry.Registry
+	timeout     time.Duration
+	balancer    string
+	pickBuilder base.PickerBuilder
+
+	healthCheck   bool
+	healthService string
+	healthHook    HealthHook
+
+	middleware       []middleware.ClientMiddleware
+	streamMiddleware []middleware.ClientStreamMiddleware
 }
 
+// HealthHook 节点健康状态变化时回调，healthy为false表示节点已从picker中摘除
+type HealthHook func(addr resolver.Address, healthy bool)
+
 type ClientOption func(client *Client)
 
 func NewClient(opts ...ClientOption) (*Client, error) {
@@ -25,6 +46,26 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	for _, opt := range opts {
 		opt(res)
 	}
+
+	if res.healthCheck && res.pickBuilder == nil {
+		res.balancer = defaultHealthBalancer
+		res.pickBuilder = &round_robin.Builder{}
+	}
+	if res.pickBuilder != nil {
+		if res.healthHook != nil {
+			res.balancer = fmt.Sprintf("%s_%d", res.balancer, atomic.AddInt64(&balancerSeq, 1))
+		}
+		builder := base.NewBalancerBuilder(res.balancer, res.pickBuilder, base.Config{
+			HealthCheck: true,
+		})
+		if res.healthHook != nil {
+			builder = &healthBalancerBuilder{
+				Builder: builder,
+				hook:    res.healthHook,
+			}
+		}
+		balancer.Register(builder)
+	}
 	return res, nil
 }
 
@@ -43,10 +84,33 @@ func ClientWithRegistry(r registry.Registry, timeout time.Duration) ClientOption
 
 func ClientWithPickBuilder(name string, b base.PickerBuilder) ClientOption {
 	return func(client *Client) {
-		balancer.Register(base.NewBalancerBuilder(name, b, base.Config{
-			HealthCheck: true,
-		}))
 		client.balancer = name
+		client.pickBuilder = b
+	}
+}
+
+// ClientWithHealthCheck 开启客户端健康检查，使用服务端的 grpc.health.v1 服务
+// service为检查的服务名，为空表示整个服务端；不健康的节点不会被picker选中
+// hook可以为nil
+func ClientWithHealthCheck(service string, hook HealthHook) ClientOption {
+	return func(client *Client) {
+		client.healthCheck = true
+		client.healthService = service
+		client.healthHook = hook
+	}
+}
+
+// ClientWithMiddleware 客户端一元调用的中间件，按添加顺序执行，先于Dial时传入的拦截器
+func ClientWithMiddleware(middleware middleware.ClientMiddleware) ClientOption {
+	return func(client *Client) {
+		client.middleware = append(client.middleware, middleware)
+	}
+}
+
+// ClientWithStreamMiddleware 客户端流式调用的中间件，按添加顺序执行
+func ClientWithStreamMiddleware(middleware middleware.ClientStreamMiddleware) ClientOption {
+	return func(client *Client) {
+		client.streamMiddleware = append(client.streamMiddleware, middleware)
 	}
 }
 
@@ -62,13 +126,25 @@ func (c *Client) Dial(ctx context.Context, serviceName string, options ...grpc.D
 	}
 
 	if c.balancer != "" {
-		opts = append(opts, grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"LoadBalancingPolicy": "%s"}`, c.balancer)))
+		if c.healthCheck {
+			opts = append(opts, grpc.WithDefaultServiceConfig(fmt.Sprintf(
+				`{"LoadBalancingPolicy": "%s", "healthCheckConfig": {"serviceName": "%s"}}`, c.balancer, c.healthService)))
+		} else {
+			opts = append(opts, grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"LoadBalancingPolicy": "%s"}`, c.balancer)))
+		}
 	}
 
 	if c.insecure {
 		opts = append(opts, grpc.WithInsecure())
 	}
 
+	if len(c.middleware) != 0 {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(middleware.BuildClientInterceptor(c.middleware)))
+	}
+	if len(c.streamMiddleware) != 0 {
+		opts = append(opts, grpc.WithChainStreamInterceptor(middleware.BuildClientStreamInterceptor(c.streamMiddleware)))
+	}
+
 	if len(options) != 0 {
 		opts = append(opts, options...)
 	}
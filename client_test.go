@@ -0,0 +1,174 @@
+package micro
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"micro/demo/grpc/proto"
+	"micro/middleware"
+	"micro/registry/memory"
+	"testing"
+	"time"
+)
+
+func TestClient_HealthCheck(t *testing.T) {
+	r := memory.NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+
+	server, err := NewServer("user-service", ServerWithRegister(r))
+	require.NoError(t, err)
+	proto.RegisterUserServiceServer(server, &userServer{})
+	go func() {
+		_ = server.Start("127.0.0.1:0")
+	}()
+	defer server.Stop()
+	require.Eventually(t, func() bool {
+		instances, er := r.ListServices(context.Background(), "user-service")
+		return er == nil && len(instances) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	health := make(chan bool, 8)
+	client, err := NewClient(
+		ClientInsecure(),
+		ClientWithRegistry(r, time.Second),
+		ClientWithHealthCheck("users.UserService", func(addr resolver.Address, healthy bool) {
+			health <- healthy
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cc, err := client.Dial(ctx, "user-service")
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+	uc := proto.NewUserServiceClient(cc)
+
+	resp, err := uc.GetByID(ctx, &proto.Request{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), resp.User.Id)
+	assert.True(t, <-health)
+
+	// 服务不健康，节点被摘除
+	server.SetServingStatus("users.UserService", healthpb.HealthCheckResponse_NOT_SERVING)
+	select {
+	case healthy := <-health:
+		assert.False(t, healthy)
+	case <-time.After(time.Second):
+		t.Fatal("未收到健康状态变化")
+	}
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer timeoutCancel()
+	_, err = uc.GetByID(timeoutCtx, &proto.Request{Id: 123})
+	assert.Error(t, err)
+
+	// 恢复
+	server.SetServingStatus("users.UserService", healthpb.HealthCheckResponse_SERVING)
+	select {
+	case healthy := <-health:
+		assert.True(t, healthy)
+	case <-time.After(time.Second):
+		t.Fatal("未收到健康状态变化")
+	}
+	_, err = uc.GetByID(ctx, &proto.Request{Id: 123})
+	require.NoError(t, err)
+}
+
+func TestClient_Middleware(t *testing.T) {
+	r := memory.NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+
+	server, err := NewServer("user-service", ServerWithRegister(r))
+	require.NoError(t, err)
+	proto.RegisterUserServiceServer(server, &userServer{})
+	go func() {
+		_ = server.Start("127.0.0.1:0")
+	}()
+	defer server.Stop()
+	require.Eventually(t, func() bool {
+		instances, er := r.ListServices(context.Background(), "user-service")
+		return er == nil && len(instances) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	var order []string
+	record := func(name string) middleware.ClientMiddleware {
+		return func(handler middleware.ClientHandler) middleware.ClientHandler {
+			return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				order = append(order, name+" "+method)
+				return handler(ctx, method, req, reply, cc, opts...)
+			}
+		}
+	}
+	interceptor := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		order = append(order, "interceptor")
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		// 能看到响应
+		order = append(order, "reply "+reply.(*proto.Response).User.Name)
+		return err
+	}
+
+	client, err := NewClient(
+		ClientInsecure(),
+		ClientWithRegistry(r, time.Second),
+		ClientWithMiddleware(record("first")),
+		ClientWithMiddleware(middleware.FromUnaryClientInterceptor(interceptor)),
+		ClientWithMiddleware(record("second")),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cc, err := client.Dial(ctx, "user-service")
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	_, err = proto.NewUserServiceClient(cc).GetByID(ctx, &proto.Request{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"first /users.UserService/GetByID",
+		"interceptor",
+		"second /users.UserService/GetByID",
+		"reply hello,world",
+	}, order)
+}
+
+type userServer struct {
+	proto.UnimplementedUserServiceServer
+}
+
+func (s *userServer) GetByID(ctx context.Context, request *proto.Request) (*proto.Response, error) {
+	return &proto.Response{
+		User: &proto.User{
+			Id:   request.Id,
+			Name: "hello,world",
+		},
+	}, nil
+}
+
+func TestNewClient_HealthHookBalancer(t *testing.T) {
+	hook := func(addr resolver.Address, healthy bool) {}
+	c1, err := NewClient(ClientWithHealthCheck("", hook))
+	require.NoError(t, err)
+	c2, err := NewClient(ClientWithHealthCheck("", hook))
+	require.NoError(t, err)
+	// 每个客户端的hook注册在各自的balancer下
+	assert.NotEqual(t, c1.balancer, c2.balancer)
+	assert.NotNil(t, balancer.Get(c1.balancer))
+	assert.NotNil(t, balancer.Get(c2.balancer))
+
+	c3, err := NewClient(ClientWithHealthCheck("", nil))
+	require.NoError(t, err)
+	assert.Equal(t, defaultHealthBalancer, c3.balancer)
+}
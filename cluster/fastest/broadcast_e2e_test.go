@@ -52,7 +52,7 @@ func TestUseBroadCast(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	//ctx = context.WithValue(ctx, "group", "A")
+	//ctx = route.WithGroup(ctx, "A")
 	ctx, respCh := UseBroadCast(ctx)
 	go func() {
 		res := <-respCh
@@ -0,0 +1,83 @@
+package micro
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"sync"
+)
+
+// healthBalancerBuilder 监听SubConn状态，进入或离开READY时回调 HealthHook
+// 开启健康检查后，服务端返回NOT_SERVING的节点会变为TRANSIENT_FAILURE，不再被picker选中
+type healthBalancerBuilder struct {
+	balancer.Builder
+	hook HealthHook
+}
+
+func (h *healthBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	wrapper := &healthClientConn{
+		ClientConn: cc,
+		subConns:   make(map[balancer.SubConn]*subConnState, 8),
+	}
+	return &healthBalancer{
+		Balancer: h.Builder.Build(wrapper, opts),
+		cc:       wrapper,
+		hook:     h.hook,
+	}
+}
+
+type healthBalancer struct {
+	balancer.Balancer
+	cc   *healthClientConn
+	hook HealthHook
+}
+
+func (h *healthBalancer) UpdateSubConnState(sc balancer.SubConn, state balancer.SubConnState) {
+	if addr, ready, changed := h.cc.update(sc, state.ConnectivityState); changed {
+		h.hook(addr, ready)
+	}
+	h.Balancer.UpdateSubConnState(sc, state)
+}
+
+// healthClientConn 记录SubConn对应的地址
+type healthClientConn struct {
+	balancer.ClientConn
+	subConns map[balancer.SubConn]*subConnState
+	mutex    sync.Mutex
+}
+
+type subConnState struct {
+	addr  resolver.Address
+	ready bool
+}
+
+func (h *healthClientConn) NewSubConn(addrs []resolver.Address, opts balancer.NewSubConnOptions) (balancer.SubConn, error) {
+	sc, err := h.ClientConn.NewSubConn(addrs, opts)
+	if err != nil || len(addrs) == 0 {
+		return sc, err
+	}
+
+	h.mutex.Lock()
+	h.subConns[sc] = &subConnState{addr: addrs[0]}
+	h.mutex.Unlock()
+	return sc, nil
+}
+
+func (h *healthClientConn) update(sc balancer.SubConn, state connectivity.State) (resolver.Address, bool, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.subConns[sc]
+	if !ok {
+		return resolver.Address{}, false, false
+	}
+	if state == connectivity.Shutdown {
+		delete(h.subConns, sc)
+	}
+
+	ready := state == connectivity.Ready
+	if ready == s.ready {
+		return s.addr, ready, false
+	}
+	s.ready = ready
+	return s.addr, ready, true
+}
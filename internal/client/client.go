@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"github.com/silenceper/pool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"micro/rpc/protocol"
 	"micro/rpc/serialize"
 	"micro/rpc/serialize/json"
@@ -65,6 +67,8 @@ func (c *Client) setFuncField(service protocol.Service, p protocol.Proxy) error
 				if deadline, ok := ctx.Deadline(); ok {
 					meta["deadline"] = strconv.FormatInt(deadline.UnixMilli(), 10)
 				}
+				// 链路追踪信息
+				otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(meta))
 				req := &protocol.Request{
 					ServiceName: service.Name(),
 					MethodName:  fieldTyp.Name,
@@ -73,10 +77,16 @@ func (c *Client) setFuncField(service protocol.Service, p protocol.Proxy) error
 					Data:        reqData,
 				}
 
-				// 发起RPC调用
-				req.CalculateHeaderLength()
-				req.CalculateBodyLength()
-				resp, err := p.Invoke(ctx, req)
+				// 发起RPC调用，中间件可能修改Meta，在最后计算长度
+				var handler protocol.HandleFunc = func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+					req.CalculateHeaderLength()
+					req.CalculateBodyLength()
+					return p.Invoke(ctx, req)
+				}
+				for j := len(c.middlewares) - 1; j >= 0; j-- {
+					handler = c.middlewares[j](handler)
+				}
+				resp, err := handler(ctx, req)
 				if err != nil {
 					return []reflect.Value{retVal, reflect.ValueOf(err)}
 				}
@@ -111,13 +121,21 @@ func (c *Client) setFuncField(service protocol.Service, p protocol.Proxy) error
 }
 
 type Client struct {
-	addr       string
-	pool       pool.Pool
-	serializer serialize.Serializer
+	addr        string
+	pool        pool.Pool
+	serializer  serialize.Serializer
+	middlewares []protocol.Middleware
 }
 
 type ClientOption func(client *Client)
 
+// ClientWithMiddleware 按添加顺序执行
+func ClientWithMiddleware(middlewares ...protocol.Middleware) ClientOption {
+	return func(client *Client) {
+		client.middlewares = append(client.middlewares, middlewares...)
+	}
+}
+
 func ClientWithSerializer(serializer serialize.Serializer) ClientOption {
 	return func(client *Client) {
 		client.serializer = serializer
@@ -3,11 +3,16 @@ package server
 import (
 	"context"
 	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc/peer"
+	"log"
 	"micro/rpc/protocol"
 	"micro/rpc/serialize"
 	"micro/rpc/serialize/json"
 	"net"
 	"reflect"
+	"runtime/debug"
 	"strconv"
 	"time"
 )
@@ -15,21 +20,60 @@ import (
 // numOfLengthBytes 长度字段
 const numOfLengthBytes = 8
 
+// ErrPanic 业务方法panic时返回给客户端的错误
+var ErrPanic = errors.New("micro: 服务端内部错误")
+
 // Server 服务端
 type Server struct {
 	network     string
 	addr        string
 	service     map[string]reflectionStub
 	serializers map[uint8]serialize.Serializer
+	onPanic     PanicHandler
+	middlewares []protocol.Middleware
+	handler     protocol.HandleFunc
+}
+
+// PanicHandler 业务方法panic时回调，用于打日志或上报指标
+type PanicHandler func(ctx context.Context, req *protocol.Request, p interface{}, stack []byte)
+
+type ServerOption func(server *Server)
+
+// ServerWithPanicHandler 默认用log打印panic和调用栈
+func ServerWithPanicHandler(fn PanicHandler) ServerOption {
+	return func(server *Server) {
+		server.onPanic = fn
+	}
+}
+
+// ServerWithMiddleware 按添加顺序执行，最后调用业务方法
+func ServerWithMiddleware(middlewares ...protocol.Middleware) ServerOption {
+	return func(server *Server) {
+		server.middlewares = append(server.middlewares, middlewares...)
+	}
 }
 
 // InitServer 初始化服务端
-func InitServer(network, addr string) *Server {
+func InitServer(network, addr string, opts ...ServerOption) *Server {
 	res := &Server{
 		network:     network,
 		addr:        addr,
 		service:     make(map[string]reflectionStub, 16),
 		serializers: make(map[uint8]serialize.Serializer, 4),
+		onPanic: func(ctx context.Context, req *protocol.Request, p interface{}, stack []byte) {
+			log.Printf("micro: %s.%s panic: %v\n%s", req.ServiceName, req.MethodName, p, stack)
+		},
+	}
+
+	// 配置选项
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	// 中间件链
+	res.handler = res.Invoke
+	for i := len(res.middlewares) - 1; i >= 0; i-- {
+		res.handler = res.middlewares[i](res.handler)
 	}
 
 	// 注册默认序列化协议
@@ -103,10 +147,23 @@ func (s *Server) handleConn(conn net.Conn) error {
 				ctx, cancel = context.WithDeadline(ctx, t)
 			}
 		}
+		// 链路追踪信息
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(req.Meta))
+
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: conn.RemoteAddr()})
 
 		// TODO 处理数据
-		resp, err := s.Invoke(ctx, req)
+		resp, err := s.handler(ctx, req)
 		cancel()
+		if resp == nil {
+			// 中间件直接返回了错误
+			resp = &protocol.Response{
+				MessageID:  req.MessageID,
+				Version:    req.Version,
+				Compress:   req.Compress,
+				Serializer: req.Serializer,
+			}
+		}
 		if err != nil {
 			resp.Error = []byte(err.Error())
 		}
@@ -121,16 +178,25 @@ func (s *Server) handleConn(conn net.Conn) error {
 	}
 }
 
-func (s *Server) Invoke(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+func (s *Server) Invoke(ctx context.Context, req *protocol.Request) (resp *protocol.Response, err error) {
 	// 根据调用信息，发起业务调用
 	service, ok := s.service[req.ServiceName]
-	resp := &protocol.Response{
+	resp = &protocol.Response{
 		MessageID:  req.MessageID,
 		Version:    req.Version,
 		Compress:   req.Compress,
 		Serializer: req.Serializer,
 	}
 
+	// 业务方法panic时返回错误响应，不影响其他请求
+	defer func() {
+		if p := recover(); p != nil {
+			s.onPanic(ctx, req, p, debug.Stack())
+			resp.Data = nil
+			err = ErrPanic
+		}
+	}()
+
 	// 捕获错误
 	if !ok {
 		return resp, errors.New("调用服务不存在")
@@ -155,6 +221,9 @@ type reflectionStub struct {
 func (r *reflectionStub) invoke(ctx context.Context, req *protocol.Request) ([]byte, error) {
 	// 反射找到方法，执行调用
 	method := r.value.MethodByName(req.MethodName)
+	if !method.IsValid() {
+		return nil, errors.New("micro: 调用方法不存在")
+	}
 	in := make([]reflect.Value, 2)
 	in[0] = reflect.ValueOf(ctx)
 	inReq := reflect.New(method.Type().In(1).Elem())
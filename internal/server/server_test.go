@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"micro/rpc/protocol"
+	"micro/rpc/serialize/json"
+	"testing"
+)
+
+func TestServer_Invoke_Panic(t *testing.T) {
+	var got interface{}
+	s := InitServer("tcp", ":0", ServerWithPanicHandler(func(ctx context.Context, req *protocol.Request, p interface{}, stack []byte) {
+		got = p
+		assert.NotEmpty(t, stack)
+	}))
+	s.RegisterService(&panicService{})
+
+	data, err := (&json.Serializer{}).Encode(&panicReq{ID: 1})
+	require.NoError(t, err)
+	req := &protocol.Request{
+		ServiceName: "panic-service",
+		MethodName:  "Get",
+		Serializer:  (&json.Serializer{}).Code(),
+		Data:        data,
+	}
+	resp, err := s.Invoke(context.Background(), req)
+	assert.Equal(t, ErrPanic, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, "mock panic", got)
+
+	// 方法不存在
+	req.MethodName = "NotExist"
+	_, err = s.Invoke(context.Background(), req)
+	assert.EqualError(t, err, "micro: 调用方法不存在")
+}
+
+type panicReq struct {
+	ID int
+}
+
+type panicService struct{}
+
+func (p *panicService) Name() string {
+	return "panic-service"
+}
+
+func (p *panicService) Get(ctx context.Context, req *panicReq) (*panicReq, error) {
+	panic("mock panic")
+}
@@ -0,0 +1,65 @@
+package loadbalance
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"micro/route"
+)
+
+// ErrNoRoute 有可用节点，但没有节点符合路由规则
+var ErrNoRoute = status.Error(codes.Unavailable, "micro: 没有符合路由规则的节点")
+
+// FallbackAll 没有节点符合路由规则时，使用所有节点
+var FallbackAll route.Filter = func(info balancer.PickInfo, addr resolver.Address) bool {
+	return true
+}
+
+// Base 所有负载均衡策略共用的路由：先按Filter筛选候选节点，策略只在候选节点中选择
+type Base struct {
+	Filter route.Filter
+	// Fallback 没有节点符合Filter时改用Fallback筛选，为nil时返回 ErrNoRoute
+	Fallback route.Filter
+}
+
+func NewBase(filter, fallback route.Filter) Base {
+	return Base{
+		Filter:   filter,
+		Fallback: fallback,
+	}
+}
+
+// Candidates 返回候选节点的下标，n为节点数，addr返回第i个节点的地址
+// 没有Filter时不会调用addr
+func (b Base) Candidates(info balancer.PickInfo, n int, addr func(i int) resolver.Address) ([]int, error) {
+	if n == 0 {
+		return nil, balancer.ErrNoSubConnAvailable
+	}
+	if b.Filter == nil {
+		res := make([]int, n)
+		for i := range res {
+			res[i] = i
+		}
+		return res, nil
+	}
+
+	res := filter(info, n, addr, b.Filter)
+	if len(res) == 0 && b.Fallback != nil {
+		res = filter(info, n, addr, b.Fallback)
+	}
+	if len(res) == 0 {
+		return nil, ErrNoRoute
+	}
+	return res, nil
+}
+
+func filter(info balancer.PickInfo, n int, addr func(i int) resolver.Address, f route.Filter) []int {
+	res := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if f(info, addr(i)) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
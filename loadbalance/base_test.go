@@ -0,0 +1,135 @@
+package loadbalance_test
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"micro/loadbalance"
+	"micro/loadbalance/hash"
+	"micro/loadbalance/least_active"
+	"micro/loadbalance/p2c"
+	"micro/loadbalance/random"
+	"micro/loadbalance/round_robin"
+	weight_random "micro/loadbalance/weight_random"
+	"micro/loadbalance/weight_round_robin"
+	"micro/route"
+	routerr "micro/route/round_robin"
+	"testing"
+)
+
+type SubConn struct {
+	balancer.SubConn
+	name  string
+	group string
+}
+
+type groupKey struct{}
+
+func groupFilter(info balancer.PickInfo, addr resolver.Address) bool {
+	group, _ := info.Ctx.Value(groupKey{}).(string)
+	target, _ := addr.Attributes.Value("group").(string)
+	return group == target
+}
+
+func TestBase_Filter(t *testing.T) {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for i := 0; i < 6; i++ {
+		c := &SubConn{name: fmt.Sprintf("127.0.0.1:%d", 8080+i), group: "A"}
+		if i%3 == 0 {
+			c.group = "B"
+		}
+		info.ReadySCs[c] = base.SubConnInfo{Address: resolver.Address{
+			Addr:       c.name,
+			Attributes: attributes.New("group", c.group),
+		}}
+	}
+
+	builders := map[string]func(filter, fallback route.Filter) base.PickerBuilder{
+		"round_robin": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &round_robin.Builder{Filter: filter, Fallback: fallback}
+		},
+		"random": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &random.Builder{Filter: filter, Fallback: fallback}
+		},
+		"weight_random": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &weight_random.Builder{Filter: filter, Fallback: fallback}
+		},
+		"weight_round_robin": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &weight_round_robin.BalancerBuilder{Filter: filter, Fallback: fallback}
+		},
+		"least_active": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &least_active.Builder{Filter: filter, Fallback: fallback}
+		},
+		"hash": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &hash.Builder{Filter: filter, Fallback: fallback}
+		},
+		"bounded_hash": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &hash.BoundedBuilder{Filter: filter, Fallback: fallback}
+		},
+		"p2c": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &p2c.Builder{Filter: filter, Fallback: fallback}
+		},
+		"route_round_robin": func(filter, fallback route.Filter) base.PickerBuilder {
+			return &routerr.Builder{Filter: filter, Fallback: fallback}
+		},
+	}
+
+	for name, newBuilder := range builders {
+		t.Run(name, func(t *testing.T) {
+			var results []balancer.PickResult
+			pick := func(p balancer.Picker, group string, i int) (*SubConn, error) {
+				ctx := hash.WithHashKey(context.Background(), fmt.Sprintf("user-%d", i))
+				ctx = context.WithValue(ctx, groupKey{}, group)
+				res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, res)
+				return res.SubConn.(*SubConn), nil
+			}
+
+			p := newBuilder(groupFilter, nil).Build(info)
+			seen := map[string]bool{}
+			// 请求都没有结束，least_active 等策略也会用到所有候选节点
+			for i := 0; i < 100; i++ {
+				c, err := pick(p, "B", i)
+				require.NoError(t, err)
+				assert.Equal(t, "B", c.group)
+				seen[c.name] = true
+			}
+			assert.Len(t, seen, 2)
+			for _, res := range results {
+				res.Done(balancer.DoneInfo{})
+			}
+
+			// 没有符合的节点
+			_, err := pick(p, "C", 0)
+			assert.Equal(t, loadbalance.ErrNoRoute, err)
+
+			// 使用所有节点兜底
+			p = newBuilder(groupFilter, loadbalance.FallbackAll).Build(info)
+			c, err := pick(p, "C", 0)
+			require.NoError(t, err)
+			assert.NotNil(t, c)
+
+			// 过滤链
+			p = newBuilder(route.And(groupFilter, func(info balancer.PickInfo, addr resolver.Address) bool {
+				return addr.Addr == "127.0.0.1:8083"
+			}), nil).Build(info)
+			for i := 0; i < 10; i++ {
+				c, err = pick(p, "B", i)
+				require.NoError(t, err)
+				assert.Equal(t, "127.0.0.1:8083", c.name)
+			}
+
+			// 没有节点
+			_, err = newBuilder(groupFilter, nil).Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{Ctx: context.Background()})
+			assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+		})
+	}
+}
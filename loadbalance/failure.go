@@ -0,0 +1,25 @@
+package loadbalance
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNotSent 选中节点后请求没有发出，例如被熔断器拦截
+// PickResult.Done 收到该错误时只释放活跃请求数等占用，不记录调用结果
+var ErrNotSent = errors.New("micro: 请求没有发出")
+
+// IsFailure 调用结果是否说明节点有问题，负载均衡和熔断共用
+// 调用方自身的问题（参数错误、未认证等）和主动取消不计入失败
+func IsFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNotSent) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.OK, codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange:
+		return false
+	}
+	return true
+}
@@ -1,29 +1,56 @@
 package hash
 
 import (
+	"golang.org/x/net/context"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
-	"hash/crc32"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"micro/loadbalance"
+	"micro/registry"
 	"micro/route"
 )
 
+// DefaultReplicas 权重为 registry.DefaultWeight 的节点的虚拟节点数
+const DefaultReplicas = 160
+
+// MaxReplicasFactor 单个节点的虚拟节点数最多为 Replicas 的倍数
+// 权重可以来自SRV记录（最大65535）等外部数据，不限制时环的大小会失控
+const MaxReplicasFactor = 10
+
+// ErrNoHashKey 没有通过 WithHashKey 设置哈希的key
+var ErrNoHashKey = status.Error(codes.InvalidArgument, "micro: 一致性哈希缺少key")
+
+type hashKey struct{}
+
+// WithHashKey 设置一致性哈希的key，相同key的请求会落到同一个节点
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
+
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(hashKey{}).(string)
+	return key, ok
+}
+
 type Balancer struct {
-	connections []balancer.SubConn
-	len         int32
-	filter      route.Filter
+	ring   *ring
+	router loadbalance.Base
 }
 
 func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	if b.len == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	candidates, err := b.router.Candidates(info, len(b.ring.nodes), b.ring.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
-	hashCode := info.Ctx.Value("hash_code").([]byte)
-	idx := int(crc32.ChecksumIEEE(hashCode))
+	key, ok := HashKeyFromContext(info.Ctx)
+	if !ok {
+		return balancer.PickResult{}, ErrNoHashKey
+	}
 
-	conn := b.connections[idx]
 	return balancer.PickResult{
-		SubConn: conn,
+		SubConn: b.ring.nodes[b.ring.get([]byte(key), candidates)].conn,
 		Done: func(info balancer.DoneInfo) {
 
 		},
@@ -32,17 +59,55 @@ func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 
 type Builder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
+	// Replicas 每个节点的虚拟节点数，按权重等比例缩放，默认 DefaultReplicas
+	Replicas int
+	// Hash 默认 FNV
+	Hash HashFunc
 }
 
 func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
-	connections := make([]balancer.SubConn, 0, len(info.ReadySCs))
+	nodes, replicas := b.nodes(info)
+	return &Balancer{
+		ring:   newRing(nodes, replicas, b.hash()),
+		router: loadbalance.NewBase(b.Filter, b.Fallback),
+	}
+}
 
-	for conn := range info.ReadySCs {
-		connections = append(connections, conn)
+// nodes 虚拟节点数超过上限时，所有节点按最大的节点等比例缩小，保持权重比例
+func (b *Builder) nodes(info base.PickerBuildInfo) ([]node, []int) {
+	per := b.Replicas
+	if per <= 0 {
+		per = DefaultReplicas
 	}
+	nodes := make([]node, 0, len(info.ReadySCs))
+	replicas := make([]int, 0, len(info.ReadySCs))
+	most := 0
+	for conn, sci := range info.ReadySCs {
+		nodes = append(nodes, node{conn: conn, addr: sci.Address})
+		n := per * int(registry.WeightOf(sci.Address.Attributes)) / int(registry.DefaultWeight)
+		replicas = append(replicas, n)
+		if n > most {
+			most = n
+		}
+	}
+	limit := per * MaxReplicasFactor
+	for i, n := range replicas {
+		if most > limit {
+			n = n * limit / most
+		}
+		if n <= 0 {
+			n = 1
+		}
+		replicas[i] = n
+	}
+	return nodes, replicas
+}
 
-	return &Balancer{
-		connections: connections,
-		len:         int32(len(connections)),
+func (b *Builder) hash() HashFunc {
+	if b.Hash == nil {
+		return FNV
 	}
+	return b.Hash
 }
@@ -0,0 +1,121 @@
+package hash
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"math"
+	"micro/registry"
+	"testing"
+)
+
+type SubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func buildInfo(conns []*SubConn) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for _, c := range conns {
+		info.ReadySCs[c] = base.SubConnInfo{Address: resolver.Address{Addr: c.name}}
+	}
+	return info
+}
+
+func pick(t *testing.T, p balancer.Picker, key string) string {
+	res, err := p.Pick(balancer.PickInfo{Ctx: WithHashKey(context.Background(), key)})
+	require.NoError(t, err)
+	return res.SubConn.(*SubConn).name
+}
+
+func TestBalancer_Pick(t *testing.T) {
+	b := &Builder{}
+	_, err := b.Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{Ctx: WithHashKey(context.Background(), "a")})
+	assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+
+	conns := make([]*SubConn, 0, 5)
+	for i := 0; i < 5; i++ {
+		conns = append(conns, &SubConn{name: fmt.Sprintf("127.0.0.1:%d", 8080+i)})
+	}
+	p := b.Build(buildInfo(conns))
+	_, err = p.Pick(balancer.PickInfo{Ctx: context.Background()})
+	assert.Equal(t, ErrNoHashKey, err)
+
+	const keys = 10000
+	before := make(map[string]string, keys)
+	counts := make(map[string]int, len(conns))
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		before[key] = pick(t, p, key)
+		counts[before[key]]++
+		// 相同key总是同一个节点
+		assert.Equal(t, before[key], pick(t, p, key))
+	}
+	for _, c := range conns {
+		assert.InDelta(t, keys/len(conns), counts[c.name], float64(keys/len(conns))*0.3, c.name)
+	}
+
+	// 摘除一个节点，只有原本落在该节点上的key会迁移；SubConn重建不影响映射
+	rebuilt := make([]*SubConn, 0, len(conns)-1)
+	for _, c := range conns[1:] {
+		rebuilt = append(rebuilt, &SubConn{name: c.name})
+	}
+	p = b.Build(buildInfo(rebuilt))
+	for key, addr := range before {
+		got := pick(t, p, key)
+		if addr != conns[0].name {
+			assert.Equal(t, addr, got, key)
+		}
+	}
+
+	// 加入一个节点，迁移的key都去了新节点
+	added := append(rebuilt, conns[0], &SubConn{name: "127.0.0.1:9090"})
+	p = b.Build(buildInfo(added))
+	moved := 0
+	for key, addr := range before {
+		got := pick(t, p, key)
+		if got != addr {
+			moved++
+			assert.Equal(t, "127.0.0.1:9090", got, key)
+		}
+	}
+	assert.InDelta(t, keys/(len(conns)+1), moved, float64(keys/(len(conns)+1))*0.3)
+}
+
+func TestBuilder_Weight(t *testing.T) {
+	heavy := &SubConn{name: "127.0.0.1:8080"}
+	light := &SubConn{name: "127.0.0.1:8081"}
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		heavy: {Address: resolver.Address{Addr: heavy.name, Attributes: attributes.New(registry.AttributeWeight, uint32(30))}},
+		light: {Address: resolver.Address{Addr: light.name}},
+	}}
+	p := (&Builder{}).Build(info)
+	counts := map[string]int{}
+	for i := 0; i < 8000; i++ {
+		counts[pick(t, p, fmt.Sprintf("user-%d", i))]++
+	}
+	assert.InDelta(t, 6000, counts[heavy.name], 600)
+}
+
+func TestBuilder_MaxReplicas(t *testing.T) {
+	heavy := &SubConn{name: "127.0.0.1:8080"}
+	light := &SubConn{name: "127.0.0.1:8081"}
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		heavy: {Address: resolver.Address{Addr: heavy.name, Attributes: attributes.New(registry.AttributeWeight, uint32(math.MaxUint32))}},
+		light: {Address: resolver.Address{Addr: light.name, Attributes: attributes.New(registry.AttributeWeight, uint32(math.MaxUint32/4))}},
+	}}
+	nodes, replicas := (&Builder{}).nodes(info)
+	// 超过上限时等比例缩小
+	for i, n := range nodes {
+		if n.conn == heavy {
+			assert.Equal(t, DefaultReplicas*MaxReplicasFactor, replicas[i])
+		} else {
+			assert.InDelta(t, DefaultReplicas*MaxReplicasFactor/4, replicas[i], 1)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package hash
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"math"
+	"micro/loadbalance"
+	"micro/route"
+	"sync"
+)
+
+// DefaultLoadFactor 节点的活跃请求数最多为平均值的1.25倍
+const DefaultLoadFactor = 1.25
+
+// BoundedBalancer 有界负载的一致性哈希
+// 节点的活跃请求数超过 c×平均值 时，顺时针溢出到环上的下一个节点
+type BoundedBalancer struct {
+	ring   *ring
+	factor float64
+	router loadbalance.Base
+	loads  *inflight
+}
+
+// inflight 每个SubConn的活跃请求数，不存在表示0
+// 保存在builder中，picker重建后计数不会丢失，旧picker上请求的Done也扣减同一个计数；
+// SubConn在所有ClientConn中唯一，多个ClientConn共用builder时互不影响。计数归零时删除，不需要额外清理
+type inflight struct {
+	mutex sync.Mutex
+	loads map[balancer.SubConn]int
+}
+
+func (f *inflight) done(conn balancer.SubConn) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.loads[conn]--; f.loads[conn] <= 0 {
+		delete(f.loads, conn)
+	}
+}
+
+func (b *BoundedBalancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	candidates, err := b.router.Candidates(info, len(b.ring.nodes), b.ring.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
+	}
+
+	key, ok := HashKeyFromContext(info.Ctx)
+	if !ok {
+		return balancer.PickResult{}, ErrNoHashKey
+	}
+
+	b.loads.mutex.Lock()
+	conn := b.ring.nodes[b.pick(b.ring.search([]byte(key)), candidates)].conn
+	b.loads.loads[conn]++
+	b.loads.mutex.Unlock()
+
+	var once sync.Once
+	return balancer.PickResult{
+		SubConn: conn,
+		Done: func(info balancer.DoneInfo) {
+			once.Do(func() {
+				b.loads.done(conn)
+			})
+		},
+	}, nil
+}
+
+// pick 从第start个虚拟节点开始，返回第一个没有超过上限的候选节点
+// 上限至少是候选节点平均值向上取整，所以一定存在这样的节点
+// 调用方持有 b.loads.mutex
+func (b *BoundedBalancer) pick(start int, candidates []int) int {
+	total := 0
+	for _, i := range candidates {
+		total += b.loads.loads[b.ring.nodes[i].conn]
+	}
+	mask := b.ring.mask(candidates)
+	limit := int(math.Ceil(b.factor * float64(total+1) / float64(len(candidates))))
+	for i := 0; i < len(b.ring.points); i++ {
+		idx := b.ring.points[(start+i)%len(b.ring.points)].node
+		if mask[idx] && b.loads.loads[b.ring.nodes[idx].conn] < limit {
+			return idx
+		}
+	}
+	return candidates[0]
+}
+
+type BoundedBuilder struct {
+	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
+	// Replicas 每个节点的虚拟节点数，按权重等比例缩放，默认 DefaultReplicas
+	Replicas int
+	// Hash 默认 FNV
+	Hash HashFunc
+	// LoadFactor 即c，必须大于1，越小负载越均衡、key的亲和性越差，默认 DefaultLoadFactor
+	LoadFactor float64
+
+	once  sync.Once
+	loads *inflight
+}
+
+func (b *BoundedBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	builder := &Builder{Replicas: b.Replicas, Hash: b.Hash}
+	nodes, replicas := builder.nodes(info)
+	factor := b.LoadFactor
+	if factor <= 1 {
+		factor = DefaultLoadFactor
+	}
+	b.once.Do(func() {
+		b.loads = &inflight{loads: make(map[balancer.SubConn]int, 8)}
+	})
+	return &BoundedBalancer{
+		ring:   newRing(nodes, replicas, builder.hash()),
+		factor: factor,
+		router: loadbalance.NewBase(b.Filter, b.Fallback),
+		loads:  b.loads,
+	}
+}
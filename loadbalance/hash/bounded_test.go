@@ -0,0 +1,75 @@
+package hash
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/balancer"
+	"testing"
+)
+
+func TestBoundedBalancer_Pick(t *testing.T) {
+	conns := make([]*SubConn, 0, 4)
+	for i := 0; i < 4; i++ {
+		conns = append(conns, &SubConn{name: fmt.Sprintf("127.0.0.1:%d", 8080+i)})
+	}
+	builder := &BoundedBuilder{LoadFactor: 1.5}
+	p := builder.Build(buildInfo(conns))
+	plain := (&Builder{}).Build(buildInfo(conns))
+
+	// 没有并发请求时和普通的一致性哈希一致
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		res, err := p.Pick(balancer.PickInfo{Ctx: WithHashKey(context.Background(), key)})
+		require.NoError(t, err)
+		assert.Equal(t, pick(t, plain, key), res.SubConn.(*SubConn).name)
+		res.Done(balancer.DoneInfo{})
+	}
+
+	// 热点key：活跃请求数超过 ceil(1.5×(total+1)/4) 后溢出到其他节点
+	ctx := WithHashKey(context.Background(), "hot")
+	home := pick(t, plain, "hot")
+	loads := map[string]int{}
+	var results []balancer.PickResult
+	for i := 0; i < 40; i++ {
+		res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+		require.NoError(t, err)
+		loads[res.SubConn.(*SubConn).name]++
+		results = append(results, res)
+	}
+	assert.Equal(t, 15, loads[home])
+	for _, c := range conns {
+		assert.LessOrEqual(t, loads[c.name], 15, c.name)
+	}
+
+	// 节点变化重建picker后，活跃请求数仍然有效
+	p = builder.Build(buildInfo(conns))
+	res, err := p.Pick(balancer.PickInfo{Ctx: ctx})
+	require.NoError(t, err)
+	results = append(results, res)
+	total := 0
+	for _, c := range conns {
+		total += builder.loads.loads[c]
+	}
+	assert.Equal(t, 41, total)
+
+	// 另一个ClientConn共用builder，计数互不影响
+	others := make([]*SubConn, 0, 4)
+	for _, c := range conns {
+		others = append(others, &SubConn{name: c.name})
+	}
+	res, err = builder.Build(buildInfo(others)).Pick(balancer.PickInfo{Ctx: ctx})
+	require.NoError(t, err)
+	assert.Equal(t, home, res.SubConn.(*SubConn).name)
+	results = append(results, res)
+
+	// 请求结束后回到原来的节点，旧picker上的请求扣减的是同一个计数
+	for _, res := range results {
+		res.Done(balancer.DoneInfo{})
+		// 重复调用Done不会重复扣减
+		res.Done(balancer.DoneInfo{})
+	}
+	assert.Empty(t, builder.loads.loads)
+	assert.Equal(t, home, pick(t, p, "hot"))
+}
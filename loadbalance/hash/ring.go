@@ -0,0 +1,112 @@
+package hash
+
+import (
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// HashFunc 计算key在环上的位置
+type HashFunc func(data []byte) uint64
+
+// FNV fnv-1a 64位，再打散一次，相近的key（如 addr#1、addr#2）也能均匀分布
+func FNV(data []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb3f99ed8d01d
+	x ^= x >> 33
+	return x
+}
+
+type node struct {
+	conn balancer.SubConn
+	addr resolver.Address
+}
+
+type point struct {
+	hash uint64
+	node int
+}
+
+// ring 一致性哈希环
+// 虚拟节点由节点地址计算，和SubConn无关，节点增减时只有相邻区间的key会迁移
+type ring struct {
+	nodes  []node
+	points []point
+	hash   HashFunc
+}
+
+// newRing replicas[i] 为第i个节点的虚拟节点数
+func newRing(nodes []node, replicas []int, hash HashFunc) *ring {
+	total := 0
+	for _, n := range replicas {
+		total += n
+	}
+	res := &ring{
+		nodes:  nodes,
+		points: make([]point, 0, total),
+		hash:   hash,
+	}
+	for i, n := range nodes {
+		for j := 0; j < replicas[i]; j++ {
+			res.points = append(res.points, point{
+				hash: hash([]byte(n.addr.Addr + "#" + strconv.Itoa(j))),
+				node: i,
+			})
+		}
+	}
+	sort.Slice(res.points, func(i, j int) bool {
+		a, b := res.points[i], res.points[j]
+		if a.hash != b.hash {
+			return a.hash < b.hash
+		}
+		// 哈希冲突时按地址排序，保证和节点的遍历顺序无关
+		return res.nodes[a.node].addr.Addr < res.nodes[b.node].addr.Addr
+	})
+	return res
+}
+
+// search 返回顺时针方向第一个虚拟节点的下标
+func (r *ring) search(key []byte) int {
+	h := r.hash(key)
+	idx := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i].hash >= h
+	})
+	if idx == len(r.points) {
+		idx = 0
+	}
+	return idx
+}
+
+// get 返回key所在的节点，跳过不在candidates中的节点
+func (r *ring) get(key []byte, candidates []int) int {
+	start := r.search(key)
+	if len(candidates) == len(r.nodes) {
+		return r.points[start].node
+	}
+	mask := r.mask(candidates)
+	for i := 0; i < len(r.points); i++ {
+		if idx := r.points[(start+i)%len(r.points)].node; mask[idx] {
+			return idx
+		}
+	}
+	return candidates[0]
+}
+
+func (r *ring) mask(candidates []int) []bool {
+	res := make([]bool, len(r.nodes))
+	for _, i := range candidates {
+		res[i] = true
+	}
+	return res
+}
+
+func (r *ring) addr(i int) resolver.Address {
+	return r.nodes[i].addr
+}
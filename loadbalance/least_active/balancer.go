@@ -3,7 +3,8 @@ package least_active
 import (
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
-	"math"
+	"google.golang.org/grpc/resolver"
+	"micro/loadbalance"
 	"micro/route"
 	"sync"
 	"sync/atomic"
@@ -13,21 +14,21 @@ type Balancer struct {
 	connections []*activeConn
 	len         int32
 	mutex       sync.Mutex
-	filter      route.Filter
+	router      loadbalance.Base
 }
 
 func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	if b.len == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	candidates, err := b.router.Candidates(info, len(b.connections), b.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
-	res := &activeConn{
-		count: math.MaxUint32,
-	}
-	for _, c := range b.connections {
-		if atomic.LoadUint32(&c.count) < res.count {
-			res = c
-			break
+	res := b.connections[candidates[0]]
+	count := atomic.LoadUint32(&res.count)
+	for _, i := range candidates[1:] {
+		c := b.connections[i]
+		if cnt := atomic.LoadUint32(&c.count); cnt < count {
+			res, count = c, cnt
 		}
 	}
 
@@ -35,30 +36,40 @@ func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	return balancer.PickResult{
 		SubConn: res.conn,
 		Done: func(info balancer.DoneInfo) {
-			atomic.AddUint32(&res.count, -1)
+			atomic.AddUint32(&res.count, ^uint32(0))
 		},
 	}, nil
 }
 
+func (b *Balancer) addr(i int) resolver.Address {
+	return b.connections[i].addr
+}
+
 type Builder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
 }
 
 func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
 	connections := make([]*activeConn, 0, len(info.ReadySCs))
 
-	for c := range info.ReadySCs {
+	for c, ci := range info.ReadySCs {
 		connections = append(connections, &activeConn{
 			conn: c,
+			addr: ci.Address,
 		})
 	}
 
 	return &Balancer{
 		connections: connections,
+		len:         int32(len(connections)),
+		router:      loadbalance.NewBase(b.Filter, b.Fallback),
 	}
 }
 
 type activeConn struct {
 	conn  balancer.SubConn
+	addr  resolver.Address
 	count uint32
 }
@@ -0,0 +1,219 @@
+package p2c
+
+import (
+	"errors"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"math"
+	"math/rand"
+	"micro/loadbalance"
+	"micro/route"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDecayTime 延迟的衰减时间常数，慢节点恢复后几秒内就会重新分到流量
+	DefaultDecayTime = 5 * time.Second
+	// DefaultPenalty 失败的请求和没有延迟数据的节点按该延迟计算
+	DefaultPenalty = time.Second
+)
+
+// Balancer power of two choices：随机选两个节点，取得分低的
+// 得分 = peak-EWMA延迟 × (活跃请求数+1)
+type Balancer struct {
+	connections []*conn
+	router      loadbalance.Base
+	stats       *stats
+	intn        func(n int) int
+}
+
+func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	candidates, err := b.router.Candidates(info, len(b.connections), b.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
+	}
+
+	b.stats.mutex.Lock()
+	now := b.stats.now()
+	res := b.connections[candidates[0]].conn
+	if n := len(candidates); n > 1 {
+		i := b.intn(n)
+		j := b.intn(n - 1)
+		if j >= i {
+			j++
+		}
+		res = b.connections[candidates[i]].conn
+		if other := b.connections[candidates[j]].conn; b.stats.score(other, now) < b.stats.score(res, now) {
+			res = other
+		}
+	}
+	s := b.stats.get(res)
+	s.inflight++
+	b.stats.mutex.Unlock()
+
+	var once sync.Once
+	return balancer.PickResult{
+		SubConn: res,
+		Done: func(info balancer.DoneInfo) {
+			once.Do(func() {
+				if errors.Is(info.Err, loadbalance.ErrNotSent) {
+					b.stats.release(s)
+					return
+				}
+				b.stats.done(s, now, loadbalance.IsFailure(info.Err))
+			})
+		},
+	}, nil
+}
+
+func (b *Balancer) addr(i int) resolver.Address {
+	return b.connections[i].addr
+}
+
+type conn struct {
+	conn balancer.SubConn
+	addr resolver.Address
+}
+
+// stats 每个SubConn的统计，保存在Builder中，picker重建时不会丢失
+// SubConn在所有ClientConn中唯一，多个ClientConn共用Builder时互不影响
+type stats struct {
+	decay   float64
+	penalty float64
+	now     func() time.Time
+
+	mutex sync.Mutex
+	stats map[balancer.SubConn]*stat
+}
+
+type stat struct {
+	inflight int
+	// ewma 单位纳秒，为0表示还没有数据
+	ewma  float64
+	stamp time.Time
+}
+
+// get 调用方持有锁
+func (s *stats) get(conn balancer.SubConn) *stat {
+	res, ok := s.stats[conn]
+	if !ok {
+		res = &stat{}
+		s.stats[conn] = res
+	}
+	return res
+}
+
+// done 延迟高于当前值时直接取峰值，低于当前值时按时间间隔衰减
+func (s *stats) done(st *stat, start time.Time, failure bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st.inflight--
+	now := s.now()
+	rtt := float64(now.Sub(start))
+	if failure && rtt < s.penalty {
+		rtt = s.penalty
+	}
+	if st.ewma == 0 || rtt > st.ewma {
+		st.ewma = rtt
+	} else {
+		w := s.weight(st, now)
+		st.ewma = st.ewma*w + rtt*(1-w)
+	}
+	st.stamp = now
+}
+
+// release 请求没有发出，只减少活跃请求数
+func (s *stats) release(st *stat) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	st.inflight--
+}
+
+// score 长时间没有请求时延迟逐渐衰减，被判定为慢的节点也会重新得到试探的机会，调用方持有锁
+func (s *stats) score(conn balancer.SubConn, now time.Time) float64 {
+	st, ok := s.stats[conn]
+	if !ok {
+		return 0
+	}
+	ewma := st.ewma * s.weight(st, now)
+	if ewma == 0 && st.inflight > 0 {
+		// 新节点还没有返回过结果，按Penalty计算，避免一下子把请求都打过去
+		return s.penalty * float64(st.inflight+1)
+	}
+	return ewma * float64(st.inflight+1)
+}
+
+func (s *stats) weight(st *stat, now time.Time) float64 {
+	elapsed := now.Sub(st.stamp)
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp(-float64(elapsed) / s.decay)
+}
+
+// prune 没有活跃请求、延迟已经衰减完的统计和新节点没有区别，删除后不影响选择
+// 已经下线的节点由此清理，不需要知道属于哪个ClientConn
+func (s *stats) prune() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	for conn, st := range s.stats {
+		if st.inflight == 0 && now.Sub(st.stamp) >= 10*time.Duration(s.decay) {
+			delete(s.stats, conn)
+		}
+	}
+}
+
+type Builder struct {
+	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
+	// DecayTime 默认 DefaultDecayTime
+	DecayTime time.Duration
+	// Penalty 默认 DefaultPenalty
+	Penalty time.Duration
+
+	once  sync.Once
+	stats *stats
+	now   func() time.Time
+}
+
+func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
+	b.once.Do(b.init)
+	b.stats.prune()
+
+	connections := make([]*conn, 0, len(info.ReadySCs))
+	for c, sci := range info.ReadySCs {
+		connections = append(connections, &conn{
+			conn: c,
+			addr: sci.Address,
+		})
+	}
+
+	return &Balancer{
+		connections: connections,
+		router:      loadbalance.NewBase(b.Filter, b.Fallback),
+		stats:       b.stats,
+		intn:        rand.Intn,
+	}
+}
+
+func (b *Builder) init() {
+	b.stats = &stats{
+		decay:   float64(b.DecayTime),
+		penalty: float64(b.Penalty),
+		now:     b.now,
+		stats:   make(map[balancer.SubConn]*stat, 8),
+	}
+	if b.stats.decay <= 0 {
+		b.stats.decay = float64(DefaultDecayTime)
+	}
+	if b.stats.penalty <= 0 {
+		b.stats.penalty = float64(DefaultPenalty)
+	}
+	if b.stats.now == nil {
+		b.stats.now = time.Now
+	}
+}
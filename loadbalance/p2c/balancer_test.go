@@ -0,0 +1,166 @@
+package p2c
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"micro/loadbalance"
+	"testing"
+	"time"
+)
+
+type SubConn struct {
+	balancer.SubConn
+	name string
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestBalancer_Pick(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	b := &Builder{now: c.Now}
+	fast := &SubConn{name: "127.0.0.1:8080"}
+	slow := &SubConn{name: "127.0.0.1:8081"}
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		fast: {Address: resolver.Address{Addr: fast.name}},
+		slow: {Address: resolver.Address{Addr: slow.name}},
+	}}
+	p := b.Build(info)
+
+	latency := map[string]time.Duration{fast.name: 10 * time.Millisecond, slow.name: 500 * time.Millisecond}
+	call := func(err error) string {
+		res, e := p.Pick(balancer.PickInfo{})
+		require.NoError(t, e)
+		name := res.SubConn.(*SubConn).name
+		c.now = c.now.Add(latency[name])
+		res.Done(balancer.DoneInfo{Err: err})
+		return name
+	}
+
+	// 两个节点都有数据之后，慢节点不再被选中
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		seen[call(nil)] = true
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, fast.name, call(nil))
+	}
+
+	// 活跃请求数也计入得分
+	var results []balancer.PickResult
+	for i := 0; i < 100; i++ {
+		res, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		results = append(results, res)
+	}
+	picked := map[string]int{}
+	for _, res := range results {
+		picked[res.SubConn.(*SubConn).name]++
+		res.Done(balancer.DoneInfo{})
+	}
+	assert.Greater(t, picked[slow.name], 0)
+
+	// 快节点开始失败，失败按Penalty计算
+	latency[slow.name] = 10 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		res, err := p.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		if res.SubConn == fast {
+			res.Done(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "unavailable")})
+		} else {
+			res.Done(balancer.DoneInfo{})
+		}
+	}
+	// 重建picker不丢失统计
+	p = b.Build(info)
+	assert.Equal(t, slow.name, call(nil))
+
+	// 一段时间后衰减，快节点重新得到请求
+	c.now = c.now.Add(30 * time.Second)
+	picked = map[string]int{}
+	for i := 0; i < 50; i++ {
+		picked[call(nil)]++
+	}
+	assert.Greater(t, picked[fast.name], 0)
+}
+
+func TestBalancer_Empty(t *testing.T) {
+	_, err := (&Builder{}).Build(base.PickerBuildInfo{}).Pick(balancer.PickInfo{})
+	assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+}
+
+func TestBalancer_NotSent(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	b := &Builder{now: c.Now}
+	sc := &SubConn{name: "127.0.0.1:8080"}
+	p := b.Build(base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{
+		sc: {Address: resolver.Address{Addr: sc.name}},
+	}})
+	res, err := p.Pick(balancer.PickInfo{})
+	require.NoError(t, err)
+	c.now = c.now.Add(time.Second)
+	// 请求没有发出，只释放活跃请求数，不记录延迟
+	res.Done(balancer.DoneInfo{Err: loadbalance.ErrNotSent})
+	st := b.stats.stats[sc]
+	assert.Equal(t, 0, st.inflight)
+	assert.Zero(t, st.ewma)
+}
+
+func TestBuilder_SharedStats(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	b := &Builder{now: c.Now}
+	build := func(conns ...*SubConn) balancer.Picker {
+		info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+		for _, sc := range conns {
+			info.ReadySCs[sc] = base.SubConnInfo{Address: resolver.Address{Addr: sc.name}}
+		}
+		return b.Build(info)
+	}
+
+	// 两个ClientConn连接相同的地址，共用Builder
+	a1, a2 := &SubConn{name: "127.0.0.1:8080"}, &SubConn{name: "127.0.0.1:8081"}
+	b1, b2 := &SubConn{name: a1.name}, &SubConn{name: a2.name}
+	pa := build(a1, a2)
+	pb := build(b1, b2)
+	res, err := pa.Pick(balancer.PickInfo{})
+	require.NoError(t, err)
+	c.now = c.now.Add(time.Second)
+	res.Done(balancer.DoneInfo{})
+	res, err = pb.Pick(balancer.PickInfo{})
+	require.NoError(t, err)
+
+	// 互不影响
+	b.stats.mutex.Lock()
+	assert.Len(t, b.stats.stats, 2)
+	for sc, st := range b.stats.stats {
+		if sc == b1 || sc == b2 {
+			assert.Equal(t, 1, st.inflight)
+			assert.Zero(t, st.ewma)
+		} else {
+			assert.Equal(t, 0, st.inflight)
+			assert.Equal(t, float64(time.Second), st.ewma)
+		}
+	}
+	// 新节点还没有返回结果，活跃请求按Penalty计算
+	assert.Equal(t, 2*float64(DefaultPenalty), b.stats.score(res.SubConn, c.now))
+	b.stats.mutex.Unlock()
+
+	// 下线的节点空闲一段时间后清理，有活跃请求的保留
+	c.now = c.now.Add(10 * DefaultDecayTime)
+	build(b1, b2)
+	b.stats.mutex.Lock()
+	assert.Len(t, b.stats.stats, 1)
+	assert.NotNil(t, b.stats.stats[res.SubConn])
+	b.stats.mutex.Unlock()
+	res.Done(balancer.DoneInfo{})
+}
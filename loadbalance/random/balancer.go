@@ -3,23 +3,27 @@ package random
 import (
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
 	"math/rand"
+	"micro/loadbalance"
 	"micro/route"
 )
 
 type Balancer struct {
 	connections []balancer.SubConn
+	addrs       []resolver.Address
 	len         int32
-	filter      route.Filter
+	router      loadbalance.Base
 }
 
 func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	if b.len == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	candidates, err := b.router.Candidates(info, len(b.connections), b.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
-	r := rand.Intn(int(b.len))
-	conn := b.connections[r]
+	r := rand.Intn(len(candidates))
+	conn := b.connections[candidates[r]]
 
 	return balancer.PickResult{
 		SubConn: conn,
@@ -29,19 +33,29 @@ func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	}, nil
 }
 
+func (b *Balancer) addr(i int) resolver.Address {
+	return b.addrs[i]
+}
+
 type Builder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
 }
 
 func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
 	connections := make([]balancer.SubConn, 0, len(info.ReadySCs))
+	addrs := make([]resolver.Address, 0, len(info.ReadySCs))
 
-	for conn := range info.ReadySCs {
+	for conn, ci := range info.ReadySCs {
 		connections = append(connections, conn)
+		addrs = append(addrs, ci.Address)
 	}
 
 	return &Balancer{
 		connections: connections,
+		addrs:       addrs,
 		len:         int32(len(connections)),
+		router:      loadbalance.NewBase(b.Filter, b.Fallback),
 	}
 }
@@ -3,24 +3,28 @@ package round_robin
 import (
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"micro/loadbalance"
 	"micro/route"
 	"sync/atomic"
 )
 
 type Balancer struct {
 	connections []balancer.SubConn
+	addrs       []resolver.Address
 	index       int32
 	len         int32
-	filter      route.Filter
+	router      loadbalance.Base
 }
 
 func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	if len(b.connections) == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	candidates, err := b.router.Candidates(info, len(b.connections), b.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
 	idx := atomic.AddInt32(&b.index, 1)
-	conn := b.connections[idx%b.len]
+	conn := b.connections[candidates[uint32(idx)%uint32(len(candidates))]]
 
 	return balancer.PickResult{
 		SubConn: conn,
@@ -30,19 +34,29 @@ func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	}, nil
 }
 
+func (b *Balancer) addr(i int) resolver.Address {
+	return b.addrs[i]
+}
+
 type Builder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
 }
 
 func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
 	connections := make([]balancer.SubConn, 0, len(info.ReadySCs))
+	addrs := make([]resolver.Address, 0, len(info.ReadySCs))
 
-	for conn := range info.ReadySCs {
+	for conn, ci := range info.ReadySCs {
 		connections = append(connections, conn)
+		addrs = append(addrs, ci.Address)
 	}
 	return &Balancer{
 		connections: connections,
+		addrs:       addrs,
 		index:       -1,
 		len:         int32(len(connections)),
+		router:      loadbalance.NewBase(b.Filter, b.Fallback),
 	}
 }
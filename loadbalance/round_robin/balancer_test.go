@@ -8,6 +8,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"math"
 	"micro/demo/grpc/proto"
 	"net"
 	"testing"
@@ -49,6 +50,21 @@ func TestBuilder_Pick(t *testing.T) {
 			wantSubConn:       SubConn{name: "127.0.0.1:8080"},
 			wantBalancerIndex: 2,
 		},
+		{
+			name: "overflow",
+			b: &Balancer{
+				connections: []balancer.SubConn{
+					SubConn{name: "127.0.0.1:8080"},
+					SubConn{name: "127.0.0.1:8081"},
+					SubConn{name: "127.0.0.1:8082"},
+				},
+				index: math.MaxInt32,
+				len:   3,
+			},
+			// 溢出后按uint32取模，2^31 % 3 = 2
+			wantSubConn:       SubConn{name: "127.0.0.1:8082"},
+			wantBalancerIndex: math.MinInt32,
+		},
 		{
 			name: "case3",
 			b: &Balancer{
@@ -3,26 +3,40 @@ package random
 import (
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
 	"math/rand"
+	"micro/loadbalance"
+	"micro/registry"
 	"micro/route"
 )
 
 type Balancer struct {
 	connections []*weightConn
-	totalWeight uint32
+	// totalWeight 用uint64累加，权重较大时不会溢出
+	totalWeight uint64
 	len         int32
-	filter      route.Filter
+	router      loadbalance.Base
 }
 
 func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	if b.len == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	candidates, err := b.router.Candidates(info, len(b.connections), b.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
-	var idx int
-	target := rand.Intn(int(b.totalWeight) + 1)
-	for i, c := range b.connections {
-		target -= int(c.weight)
+	// 只有部分节点符合路由规则时，按候选节点重新计算总权重
+	totalWeight := b.totalWeight
+	if len(candidates) < len(b.connections) {
+		totalWeight = 0
+		for _, i := range candidates {
+			totalWeight += uint64(b.connections[i].weight)
+		}
+	}
+
+	idx := candidates[0]
+	target := rand.Int63n(int64(totalWeight))
+	for _, i := range candidates {
+		target -= int64(b.connections[i].weight)
 		if target < 0 {
 			idx = i
 			break
@@ -38,20 +52,27 @@ func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	}, nil
 }
 
+func (b *Balancer) addr(i int) resolver.Address {
+	return b.connections[i].addr
+}
+
 type Builder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
 }
 
 func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
 	connections := make([]*weightConn, 0, len(info.ReadySCs))
-	var totalWeight uint32
+	var totalWeight uint64
 
 	for sub, subInfo := range info.ReadySCs {
-		weight := subInfo.Address.Attributes.Value("weight").(uint32)
-		totalWeight += weight
+		weight := registry.WeightOf(subInfo.Address.Attributes)
+		totalWeight += uint64(weight)
 
 		connections = append(connections, &weightConn{
 			conn:   sub,
+			addr:   subInfo.Address,
 			weight: weight,
 		})
 	}
@@ -60,10 +81,12 @@ func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
 		connections: connections,
 		len:         int32(len(connections)),
 		totalWeight: totalWeight,
+		router:      loadbalance.NewBase(b.Filter, b.Fallback),
 	}
 }
 
 type weightConn struct {
 	conn   balancer.SubConn
+	addr   resolver.Address
 	weight uint32
 }
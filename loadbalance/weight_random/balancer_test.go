@@ -0,0 +1,36 @@
+package random
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"math"
+	"micro/registry"
+	"testing"
+)
+
+type SubConn struct {
+	balancer.SubConn
+	name string
+}
+
+func TestBalancer_LargeWeight(t *testing.T) {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for _, name := range []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082"} {
+		si := &registry.ServiceInstance{Address: name, Weight: math.MaxUint32}
+		info.ReadySCs[&SubConn{name: name}] = base.SubConnInfo{Address: resolver.Address{Addr: name, Attributes: si.Attributes()}}
+	}
+	b := (&Builder{}).Build(info).(*Balancer)
+	// 总权重超过uint32时不会回绕
+	assert.Equal(t, uint64(3*math.MaxUint32), b.totalWeight)
+
+	picked := map[string]int{}
+	for i := 0; i < 300; i++ {
+		res, err := b.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		picked[res.SubConn.(*SubConn).name]++
+	}
+	assert.Len(t, picked, 3)
+}
@@ -1,45 +1,54 @@
 package weight_round_robin
 
 import (
+	"errors"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
 	"math"
+	"micro/loadbalance"
+	"micro/registry"
 	"micro/route"
 	"sync"
 )
 
 type Balancer struct {
 	connections []*weightConn
-	mutex       sync.Mutex
-	filter      route.Filter
+	// mutex 平滑加权轮询需要同时修改所有节点的权重
+	mutex  sync.Mutex
+	router loadbalance.Base
 }
 
 func (w *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
-	if len(w.connections) == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	candidates, err := w.router.Candidates(info, len(w.connections), w.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
-	var totalWeight uint32
+	w.mutex.Lock()
+	var totalWeight int64
 	var res *weightConn
-
-	for _, c := range w.connections {
-		c.mutex.Lock()
-		totalWeight += c.efficientWeight
-		c.currentWeight += c.efficientWeight
+	for _, i := range candidates {
+		c := w.connections[i]
+		totalWeight += int64(c.efficientWeight)
+		c.currentWeight += int64(c.efficientWeight)
 
 		if res == nil || res.currentWeight < c.currentWeight {
 			res = c
 		}
-		c.mutex.Unlock()
 	}
-	res.mutex.Lock()
 	res.currentWeight -= totalWeight
-	res.mutex.Unlock()
+	w.mutex.Unlock()
 
 	return balancer.PickResult{
 		SubConn: res.conn,
 		Done: func(info balancer.DoneInfo) {
+			// 请求没有发出，和节点无关
+			if errors.Is(info.Err, loadbalance.ErrNotSent) {
+				return
+			}
 			w.mutex.Lock()
+			defer w.mutex.Unlock()
 			if info.Err != nil && res.efficientWeight == 0 {
 				return
 			}
@@ -52,39 +61,46 @@ func (w *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 			} else {
 				res.efficientWeight++
 			}
-			w.mutex.Unlock()
 		},
 	}, nil
 }
 
+func (w *Balancer) addr(i int) resolver.Address {
+	return w.connections[i].addr
+}
+
 type BalancerBuilder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
 }
 
 func (w *BalancerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
 	connections := make([]*weightConn, 0, len(info.ReadySCs))
 
 	for sub, subInfo := range info.ReadySCs {
-		weight := subInfo.Address.Attributes.Value("weight").(int32)
+		weight := registry.WeightOf(subInfo.Address.Attributes)
 
 		// 全部初始化为weight
 		connections = append(connections, &weightConn{
 			conn:            sub,
-			weight:          uint32(weight),
-			currentWeight:   uint32(weight),
-			efficientWeight: uint32(weight),
+			addr:            subInfo.Address,
+			weight:          weight,
+			currentWeight:   int64(weight),
+			efficientWeight: weight,
 		})
 	}
 
 	return &Balancer{
 		connections: connections,
+		router:      loadbalance.NewBase(w.Filter, w.Fallback),
 	}
 }
 
 type weightConn struct {
 	conn            balancer.SubConn
+	addr            resolver.Address
 	weight          uint32
-	currentWeight   uint32
+	currentWeight   int64
 	efficientWeight uint32
-	mutex           sync.Mutex
 }
@@ -0,0 +1,230 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"math/rand"
+	"micro/middleware"
+	"micro/rpc/protocol"
+	"time"
+)
+
+// Record 一次调用的访问日志
+type Record struct {
+	Method   string
+	Peer     string
+	Duration time.Duration
+	Code     codes.Code
+	Err      error
+	// RequestSize ResponseSize 消息序列化后的字节数，流式调用为所有消息之和
+	RequestSize  int
+	ResponseSize int
+	// TraceID 没有链路追踪时为空
+	TraceID string
+	// Request Response 只有开启Payload时才有，已经按规则脱敏，流式调用不记录
+	Request  interface{}
+	Response interface{}
+}
+
+// Logger 输出访问日志，默认使用 slog.Default()
+type Logger interface {
+	Log(ctx context.Context, record *Record)
+}
+
+// Sampler 返回false的调用不记录
+type Sampler func(record *Record) bool
+
+// RateSampler 成功的调用按rate比例采样，失败的调用总是记录
+func RateSampler(rate float64) Sampler {
+	return func(record *Record) bool {
+		return record.Err != nil || rand.Float64() < rate
+	}
+}
+
+// Redactor 对请求或响应脱敏，返回值写入Record
+type Redactor func(payload interface{}) interface{}
+
+// Drop 不记录内容
+func Drop(payload interface{}) interface{} {
+	return "[REDACTED]"
+}
+
+// RedactFields 按json字段名把顶层字段替换为 ***，payload无法转成json对象时整体丢弃
+// 自定义RPC的内容是序列化后的字符串，按json解析
+func RedactFields(fields ...string) Redactor {
+	return func(payload interface{}) interface{} {
+		var data []byte
+		switch val := payload.(type) {
+		case string:
+			data = []byte(val)
+		case []byte:
+			data = val
+		default:
+			var err error
+			if data, err = json.Marshal(payload); err != nil {
+				return Drop(payload)
+			}
+		}
+		var res map[string]interface{}
+		if err := json.Unmarshal(data, &res); err != nil {
+			return Drop(payload)
+		}
+		for _, field := range fields {
+			if _, ok := res[field]; ok {
+				res[field] = "***"
+			}
+		}
+		return res
+	}
+}
+
+// RedactRule 匹配Methods（规则同 middleware.MatchMethod）的方法使用的脱敏规则，nil表示不脱敏
+type RedactRule struct {
+	Methods  []string
+	Request  Redactor
+	Response Redactor
+}
+
+type AccessLogBuilder struct {
+	Logger Logger
+	// Sampler 默认全部记录
+	Sampler Sampler
+	// Payload 是否记录请求和响应的内容
+	Payload bool
+	// Rules 按顺序匹配，使用第一条匹配的规则
+	Rules []RedactRule
+}
+
+func (b *AccessLogBuilder) logger() Logger {
+	if b.Logger != nil {
+		return b.Logger
+	}
+	return defaultLogger
+}
+
+// Build gRPC一元调用的访问日志
+func (b *AccessLogBuilder) Build() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			startTime := time.Now()
+			reply, err = handler(ctx, req)
+
+			info, _ := middleware.CallInfoFromContext(ctx)
+			record := b.newRecord(ctx, info, startTime, err)
+			record.RequestSize = size(req)
+			record.ResponseSize = size(reply)
+			b.log(ctx, record, req, reply)
+			return
+		}
+	}
+}
+
+// BuildStream gRPC流式调用的访问日志，整个流记录一条
+func (b *AccessLogBuilder) BuildStream() middleware.StreamMiddleware {
+	return func(handler middleware.StreamHandler) middleware.StreamHandler {
+		return func(srv interface{}, ss grpc.ServerStream) error {
+			startTime := time.Now()
+			var reqSize, respSize int
+			stream := middleware.WrapServerStream(ss)
+			stream.OnRecv = func(msg interface{}, err error) {
+				if err == nil {
+					reqSize += size(msg)
+				}
+			}
+			stream.OnSend = func(msg interface{}, err error) {
+				if err == nil {
+					respSize += size(msg)
+				}
+			}
+			err := handler(srv, stream)
+
+			ctx := ss.Context()
+			info, _ := middleware.CallInfoFromContext(ctx)
+			record := b.newRecord(ctx, info, startTime, err)
+			record.RequestSize = reqSize
+			record.ResponseSize = respSize
+			b.log(ctx, record, nil, nil)
+			return err
+		}
+	}
+}
+
+// BuildRPC 自定义RPC（internal/server）的访问日志，内容为序列化后的数据
+func (b *AccessLogBuilder) BuildRPC() protocol.Middleware {
+	return func(next protocol.HandleFunc) protocol.HandleFunc {
+		return func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+			startTime := time.Now()
+			resp, err := next(ctx, req)
+
+			record := b.newRecord(ctx, &middleware.CallInfo{
+				FullMethod: "/" + req.ServiceName + "/" + req.MethodName,
+			}, startTime, err)
+			record.RequestSize = len(req.Data)
+			var reqData, respData interface{}
+			if len(req.Data) > 0 {
+				reqData = string(req.Data)
+			}
+			if resp != nil && len(resp.Data) > 0 {
+				record.ResponseSize = len(resp.Data)
+				respData = string(resp.Data)
+			}
+			b.log(ctx, record, reqData, respData)
+			return resp, err
+		}
+	}
+}
+
+func (b *AccessLogBuilder) newRecord(ctx context.Context, info *middleware.CallInfo, startTime time.Time, err error) *Record {
+	record := &Record{
+		Duration: time.Since(startTime),
+		Code:     status.Code(err),
+		Err:      err,
+	}
+	if info != nil {
+		record.Method = info.FullMethod
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		record.Peer = p.Addr.String()
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		record.TraceID = sc.TraceID().String()
+	}
+	return record
+}
+
+// log 采样通过后再脱敏，避免为不记录的调用做无用功
+func (b *AccessLogBuilder) log(ctx context.Context, record *Record, req, resp interface{}) {
+	if b.Sampler != nil && !b.Sampler(record) {
+		return
+	}
+	if b.Payload && (req != nil || resp != nil) {
+		record.Request, record.Response = req, resp
+		for _, rule := range b.Rules {
+			if !middleware.MatchMethod(record.Method, rule.Methods...) {
+				continue
+			}
+			if rule.Request != nil && req != nil {
+				record.Request = rule.Request(req)
+			}
+			if rule.Response != nil && resp != nil {
+				record.Response = rule.Response(resp)
+			}
+			break
+		}
+	}
+	b.logger().Log(ctx, record)
+}
+
+// size 只计算protobuf消息的大小，其他类型为0
+func size(msg interface{}) int {
+	if m, ok := msg.(proto.Message); ok {
+		return proto.Size(m)
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"log/slog"
+	"micro/demo/grpc/proto"
+	"micro/middleware"
+	"micro/rpc/protocol"
+	"net"
+	"testing"
+)
+
+type recordLogger struct {
+	records []*Record
+}
+
+func (l *recordLogger) Log(ctx context.Context, record *Record) {
+	l.records = append(l.records, record)
+}
+
+func TestAccessLogBuilder_Build(t *testing.T) {
+	logger := &recordLogger{}
+	b := &AccessLogBuilder{
+		Logger:  logger,
+		Sampler: RateSampler(0),
+		Payload: true,
+		Rules: []RedactRule{
+			{Methods: []string{"/users.UserService/GetByID"}, Request: RedactFields("id"), Response: Drop},
+		},
+	}
+	interceptor := middleware.BuildServerInterceptor([]middleware.Middleware{b.Build()})
+	info := &grpc.UnaryServerInfo{FullMethod: "/users.UserService/GetByID"}
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 51234}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:  trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+	}))
+	req := &proto.Request{Id: 123}
+	resp := &proto.Response{User: &proto.User{Id: 123, Name: "tom"}}
+
+	// 采样率为0，成功的调用不记录
+	_, err := interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return resp, nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, logger.records)
+
+	// 失败的调用总是记录
+	_, err = interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return resp, status.Error(codes.NotFound, "not found")
+	})
+	assert.Error(t, err)
+	require.Len(t, logger.records, 1)
+	record := logger.records[0]
+	assert.Equal(t, "/users.UserService/GetByID", record.Method)
+	assert.Equal(t, "127.0.0.1:51234", record.Peer)
+	assert.Equal(t, codes.NotFound, record.Code)
+	assert.Equal(t, protobuf.Size(req), record.RequestSize)
+	assert.Equal(t, protobuf.Size(resp), record.ResponseSize)
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", record.TraceID)
+	assert.Equal(t, map[string]interface{}{"id": "***"}, record.Request)
+	assert.Equal(t, "[REDACTED]", record.Response)
+}
+
+func TestAccessLogBuilder_BuildRPC(t *testing.T) {
+	logger := &recordLogger{}
+	b := &AccessLogBuilder{Logger: logger, Payload: true, Rules: []RedactRule{
+		{Methods: []string{"/user-service/*"}, Request: RedactFields("Password")},
+	}}
+	handler := b.BuildRPC()(func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+		return &protocol.Response{Data: []byte(`{"Msg":"hello"}`)}, errors.New("mock error")
+	})
+
+	_, err := handler(context.Background(), &protocol.Request{
+		ServiceName: "user-service",
+		MethodName:  "Login",
+		Data:        []byte(`{"Name":"tom","Password":"123456"}`),
+	})
+	assert.Error(t, err)
+	require.Len(t, logger.records, 1)
+	record := logger.records[0]
+	assert.Equal(t, "/user-service/Login", record.Method)
+	assert.Equal(t, codes.Unknown, record.Code)
+	assert.Equal(t, 15, record.ResponseSize)
+	assert.Equal(t, map[string]interface{}{"Name": "tom", "Password": "***"}, record.Request)
+	assert.Equal(t, `{"Msg":"hello"}`, record.Response)
+}
+
+func TestSlogLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+	logger.Log(context.Background(), &Record{
+		Method:  "/users.UserService/GetByID",
+		Code:    codes.Internal,
+		Err:     errors.New("mock error"),
+		TraceID: "abc",
+	})
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, "ERROR", got["level"])
+	assert.Equal(t, "access", got["msg"])
+	assert.Equal(t, "/users.UserService/GetByID", got["method"])
+	assert.Equal(t, "Internal", got["code"])
+	assert.Equal(t, "abc", got["trace_id"])
+	assert.Equal(t, "mock error", got["error"])
+}
@@ -0,0 +1,51 @@
+package accesslog
+
+import (
+	"golang.org/x/net/context"
+	"log/slog"
+)
+
+var defaultLogger Logger = &SlogLogger{}
+
+var _ Logger = &SlogLogger{}
+
+// SlogLogger 用 log/slog 输出访问日志，成功的调用为Info级别，失败的为Error级别
+type SlogLogger struct {
+	// Logger 为nil时使用 slog.Default()
+	Logger *slog.Logger
+}
+
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{Logger: logger}
+}
+
+func (l *SlogLogger) Log(ctx context.Context, record *Record) {
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	level := slog.LevelInfo
+	attrs := []slog.Attr{
+		slog.String("method", record.Method),
+		slog.String("peer", record.Peer),
+		slog.Duration("duration", record.Duration),
+		slog.String("code", record.Code.String()),
+		slog.Int("request_size", record.RequestSize),
+		slog.Int("response_size", record.ResponseSize),
+	}
+	if record.TraceID != "" {
+		attrs = append(attrs, slog.String("trace_id", record.TraceID))
+	}
+	if record.Err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", record.Err.Error()))
+	}
+	if record.Request != nil {
+		attrs = append(attrs, slog.Any("request", record.Request))
+	}
+	if record.Response != nil {
+		attrs = append(attrs, slog.Any("response", record.Response))
+	}
+	logger.LogAttrs(ctx, level, "access", attrs...)
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"golang.org/x/net/context"
+)
+
+const headerAPIKey = "x-api-key"
+
+// APIKeyVerifier 静态API key，key为请求头 x-api-key 的值
+type APIKeyVerifier struct {
+	Keys map[string]*Principal
+}
+
+func (v *APIKeyVerifier) Verify(ctx context.Context, req *Request) (*Principal, error) {
+	key := req.Header.Get(headerAPIKey)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	// 逐个比较，避免按key查map带来的时间差异
+	var res *Principal
+	for k, p := range v.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			res = p
+		}
+	}
+	if res == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: res.Subject, Scheme: "apikey", Roles: res.Roles}, nil
+}
+
+// APIKey 客户端使用的API key
+func APIKey(key string) Credentials {
+	return apiKeyCredentials(key)
+}
+
+type apiKeyCredentials string
+
+func (c apiKeyCredentials) Inject(ctx context.Context, req *Request) error {
+	req.Header.Set(headerAPIKey, string(c))
+	return nil
+}
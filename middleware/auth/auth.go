@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"micro/middleware"
+	"micro/rpc/protocol"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials 请求中没有任何Verifier能识别的凭证
+	ErrNoCredentials = errors.New("micro: 缺少认证信息")
+	// ErrInvalidCredentials 凭证存在但校验失败
+	ErrInvalidCredentials = errors.New("micro: 认证失败")
+	// ErrPermissionDenied 已认证但策略不允许调用该方法
+	ErrPermissionDenied = errors.New("micro: 没有调用权限")
+)
+
+// Principal 认证通过的调用方
+type Principal struct {
+	// Subject JWT的sub、API key或HMAC的key id对应的名字
+	Subject string
+	// Scheme 认证方式，如 jwt、apikey、hmac
+	Scheme string
+	Roles  []string
+	// Claims JWT的全部声明，其他认证方式为nil
+	Claims map[string]interface{}
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext 在handler中获取调用方，公开方法没有认证时返回false
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Header 读写请求头，gRPC对应metadata，自定义RPC对应 protocol.Request.Meta
+// key统一用小写
+type Header interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+type mdHeader metadata.MD
+
+func (h mdHeader) Get(key string) string {
+	values := metadata.MD(h).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (h mdHeader) Set(key, value string) {
+	metadata.MD(h).Set(key, value)
+}
+
+type mapHeader map[string]string
+
+func (h mapHeader) Get(key string) string {
+	return h[key]
+}
+
+func (h mapHeader) Set(key, value string) {
+	h[key] = value
+}
+
+// Request 待认证（或待注入凭证）的请求
+type Request struct {
+	FullMethod string
+	Header     Header
+	payload    func() ([]byte, error)
+}
+
+// Payload 请求体序列化后的内容，只有HMAC签名需要，按需计算
+// gRPC为protobuf的确定性序列化结果，流式调用为空
+func (r *Request) Payload() ([]byte, error) {
+	if r.payload == nil {
+		return nil, nil
+	}
+	return r.payload()
+}
+
+// Verifier 校验一种凭证
+// 请求中没有这种凭证时返回 ErrNoCredentials，交给下一个Verifier
+type Verifier interface {
+	Verify(ctx context.Context, req *Request) (*Principal, error)
+}
+
+// Policy 匹配Methods（规则同 middleware.MatchMethod）的方法使用的策略
+type Policy struct {
+	Methods []string
+	// Public 不需要认证，带了凭证也会校验并放入context
+	Public bool
+	// Allow 允许的subject或角色，为空表示所有已认证的调用方
+	Allow []string
+	// Deny 拒绝的subject或角色，优先于Allow
+	Deny []string
+}
+
+func (p *Policy) permit(principal *Principal) bool {
+	if principal == nil {
+		return p.Public
+	}
+	for _, name := range p.Deny {
+		if principal.Subject == name || principal.HasRole(name) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, name := range p.Allow {
+		if principal.Subject == name || principal.HasRole(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPolicy 没有匹配的策略时，要求已认证
+var defaultPolicy = &Policy{}
+
+type AuthBuilder struct {
+	// Verifiers 按顺序尝试，第一个识别出凭证的Verifier决定结果
+	Verifiers []Verifier
+	// Policies 按顺序匹配，使用第一条匹配的策略
+	Policies []Policy
+}
+
+func (b *AuthBuilder) policy(fullMethod string) *Policy {
+	for i := range b.Policies {
+		if middleware.MatchMethod(fullMethod, b.Policies[i].Methods...) {
+			return &b.Policies[i]
+		}
+	}
+	return defaultPolicy
+}
+
+// authenticate 返回带有Principal的context
+func (b *AuthBuilder) authenticate(ctx context.Context, req *Request) (context.Context, error) {
+	var principal *Principal
+	for _, v := range b.Verifiers {
+		p, err := v.Verify(ctx, req)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return ctx, err
+		}
+		principal = p
+		break
+	}
+
+	policy := b.policy(req.FullMethod)
+	if !policy.permit(principal) {
+		if principal == nil {
+			return ctx, ErrNoCredentials
+		}
+		return ctx, ErrPermissionDenied
+	}
+	if principal != nil {
+		ctx = NewContext(ctx, principal)
+	}
+	return ctx, nil
+}
+
+// Build gRPC一元调用的认证，失败返回 codes.Unauthenticated 或 codes.PermissionDenied
+func (b *AuthBuilder) Build() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			info, _ := middleware.CallInfoFromContext(ctx)
+			ctx, err := b.authenticate(ctx, newGRPCRequest(ctx, info, req))
+			if err != nil {
+				return nil, grpcError(err)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+func (b *AuthBuilder) BuildStream() middleware.StreamMiddleware {
+	return func(handler middleware.StreamHandler) middleware.StreamHandler {
+		return func(srv interface{}, ss grpc.ServerStream) error {
+			info, _ := middleware.CallInfoFromContext(ss.Context())
+			ctx, err := b.authenticate(ss.Context(), newGRPCRequest(ss.Context(), info, nil))
+			if err != nil {
+				return grpcError(err)
+			}
+			stream := middleware.WrapServerStream(ss)
+			stream.Ctx = ctx
+			return handler(srv, stream)
+		}
+	}
+}
+
+// BuildRPC 自定义RPC（internal/server）的认证，凭证在 protocol.Request.Meta 中
+func (b *AuthBuilder) BuildRPC() protocol.Middleware {
+	return func(next protocol.HandleFunc) protocol.HandleFunc {
+		return func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+			meta := req.Meta
+			if meta == nil {
+				meta = map[string]string{}
+			}
+			ctx, err := b.authenticate(ctx, &Request{
+				FullMethod: "/" + req.ServiceName + "/" + req.MethodName,
+				Header:     mapHeader(meta),
+				payload: func() ([]byte, error) {
+					return req.Data, nil
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+func newGRPCRequest(ctx context.Context, info *middleware.CallInfo, req interface{}) *Request {
+	md, _ := metadata.FromIncomingContext(ctx)
+	res := &Request{Header: mdHeader(md)}
+	if info != nil {
+		res.FullMethod = info.FullMethod
+	}
+	if msg, ok := req.(proto.Message); ok {
+		res.payload = func() ([]byte, error) {
+			return marshal(msg)
+		}
+	}
+	return res
+}
+
+// marshal 确定性序列化，客户端和服务端得到相同的字节
+func marshal(msg proto.Message) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+func grpcError(err error) error {
+	if errors.Is(err, ErrPermissionDenied) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Unauthenticated, err.Error())
+}
+
+// bearer 取出 authorization: Bearer xxx 中的token
+func bearer(header Header) string {
+	value := header.Get("authorization")
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return ""
+}
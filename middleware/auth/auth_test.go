@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"micro/demo/grpc/proto"
+	"micro/middleware"
+	"micro/rpc/protocol"
+	"testing"
+	"time"
+)
+
+func TestAuthBuilder_Build(t *testing.T) {
+	b := &AuthBuilder{
+		Verifiers: []Verifier{
+			&JWTVerifier{Secret: []byte("secret")},
+			&APIKeyVerifier{Keys: map[string]*Principal{
+				"key-admin": {Subject: "admin-app", Roles: []string{"admin"}},
+				"key-guest": {Subject: "guest-app"},
+			}},
+			&HMACVerifier{Secrets: map[string][]byte{"order-service": []byte("hmac-secret")}},
+		},
+		Policies: []Policy{
+			{Methods: []string{"/grpc.health.v1.Health/*"}, Public: true},
+			{Methods: []string{"/users.UserService/Delete*"}, Allow: []string{"admin"}},
+			{Methods: []string{"users.UserService"}, Deny: []string{"blocked"}},
+		},
+	}
+	server := middleware.BuildServerInterceptor([]middleware.Middleware{b.Build()})
+
+	tests := []struct {
+		name     string
+		method   string
+		creds    []Credentials
+		wantCode codes.Code
+		wantSub  string
+	}{
+		{
+			name:     "no credentials",
+			method:   "/users.UserService/GetByID",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "public",
+			method:   "/grpc.health.v1.Health/Check",
+			wantCode: codes.OK,
+		},
+		{
+			name:     "public with credentials",
+			method:   "/grpc.health.v1.Health/Check",
+			creds:    []Credentials{APIKey("key-guest")},
+			wantCode: codes.OK,
+			wantSub:  "guest-app",
+		},
+		{
+			name:     "api key",
+			method:   "/users.UserService/GetByID",
+			creds:    []Credentials{APIKey("key-guest")},
+			wantCode: codes.OK,
+			wantSub:  "guest-app",
+		},
+		{
+			name:     "invalid api key",
+			method:   "/users.UserService/GetByID",
+			creds:    []Credentials{APIKey("key-other")},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "allow role",
+			method:   "/users.UserService/DeleteByID",
+			creds:    []Credentials{APIKey("key-admin")},
+			wantCode: codes.OK,
+			wantSub:  "admin-app",
+		},
+		{
+			name:     "not allowed",
+			method:   "/users.UserService/DeleteByID",
+			creds:    []Credentials{APIKey("key-guest")},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "deny",
+			method:   "/users.UserService/GetByID",
+			creds:    []Credentials{BearerToken(signHS(t, "HS256", "", []byte("secret"), map[string]interface{}{"sub": "blocked"}))},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "jwt",
+			method:   "/users.UserService/GetByID",
+			creds:    []Credentials{BearerToken(signHS(t, "HS256", "", []byte("secret"), map[string]interface{}{"sub": "tom"}))},
+			wantCode: codes.OK,
+			wantSub:  "tom",
+		},
+		{
+			name:     "hmac",
+			method:   "/users.UserService/GetByID",
+			creds:    []Credentials{HMACSigner("order-service", []byte("hmac-secret"))},
+			wantCode: codes.OK,
+			wantSub:  "order-service",
+		},
+		{
+			name:     "hmac wrong secret",
+			method:   "/users.UserService/GetByID",
+			creds:    []Credentials{HMACSigner("order-service", []byte("other"))},
+			wantCode: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sub string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				if p, ok := FromContext(ctx); ok {
+					sub = p.Subject
+				}
+				return &proto.Response{}, nil
+			}
+			// 模拟网络传输：客户端的outgoing metadata变成服务端的incoming metadata
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				_, err := server(metadata.NewIncomingContext(context.Background(), md), req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+				return err
+			}
+			client := ClientMiddleware(tt.creds...)(invoker)
+			err := client(context.Background(), tt.method, &proto.Request{Id: 123}, &proto.Response{}, nil)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantSub, sub)
+		})
+	}
+}
+
+func TestHMACVerifier_Tampered(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := &HMACVerifier{Secrets: map[string][]byte{"app": []byte("secret")}, now: func() time.Time { return now }}
+	signer := &hmacCredentials{keyID: "app", secret: []byte("secret"), now: func() time.Time { return now }}
+
+	header := mapHeader{}
+	req := &Request{FullMethod: "/user-service/Get", Header: header, payload: func() ([]byte, error) {
+		return []byte(`{"ID":1}`), nil
+	}}
+	require.NoError(t, signer.Inject(context.Background(), req))
+	p, err := v.Verify(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "app", p.Subject)
+
+	// 修改请求体
+	req.payload = func() ([]byte, error) {
+		return []byte(`{"ID":2}`), nil
+	}
+	_, err = v.Verify(context.Background(), req)
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	// 超过允许的时间偏差
+	req.payload = func() ([]byte, error) {
+		return []byte(`{"ID":1}`), nil
+	}
+	v.now = func() time.Time { return now.Add(10 * time.Minute) }
+	_, err = v.Verify(context.Background(), req)
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
+
+func TestAuthBuilder_BuildRPC(t *testing.T) {
+	b := &AuthBuilder{Verifiers: []Verifier{
+		&HMACVerifier{Secrets: map[string][]byte{"order-service": []byte("hmac-secret")}},
+	}}
+	var sub string
+	server := b.BuildRPC()(func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+		p, _ := FromContext(ctx)
+		sub = p.Subject
+		return &protocol.Response{}, nil
+	})
+	client := RPCClientMiddleware(HMACSigner("order-service", []byte("hmac-secret")))(func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+		return server(ctx, req)
+	})
+
+	req := &protocol.Request{ServiceName: "user-service", MethodName: "Get", Data: []byte(`{"ID":1}`)}
+	_, err := client(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "order-service", sub)
+	assert.NotEmpty(t, req.Meta["x-auth-signature"])
+
+	_, err = server(context.Background(), &protocol.Request{ServiceName: "user-service", MethodName: "Get"})
+	assert.True(t, errors.Is(err, ErrNoCredentials))
+}
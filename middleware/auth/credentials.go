@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"micro/middleware"
+	"micro/rpc/protocol"
+)
+
+// Credentials 客户端把凭证写入请求头
+type Credentials interface {
+	Inject(ctx context.Context, req *Request) error
+}
+
+// TokenSource 每次调用时获取token，可以在这里刷新过期的token
+type TokenSource func(ctx context.Context) (string, error)
+
+// BearerToken 固定的JWT
+func BearerToken(token string) Credentials {
+	return BearerTokenSource(func(ctx context.Context) (string, error) {
+		return token, nil
+	})
+}
+
+func BearerTokenSource(source TokenSource) Credentials {
+	return bearerCredentials{source: source}
+}
+
+type bearerCredentials struct {
+	source TokenSource
+}
+
+func (c bearerCredentials) Inject(ctx context.Context, req *Request) error {
+	token, err := c.source(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "Bearer "+token)
+	return nil
+}
+
+// ClientMiddleware gRPC一元调用注入凭证
+func ClientMiddleware(creds ...Credentials) middleware.ClientMiddleware {
+	return func(handler middleware.ClientHandler) middleware.ClientHandler {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			r := &Request{FullMethod: method}
+			if msg, ok := req.(proto.Message); ok {
+				r.payload = func() ([]byte, error) {
+					return marshal(msg)
+				}
+			}
+			ctx, err := injectOutgoing(ctx, r, creds)
+			if err != nil {
+				return err
+			}
+			return handler(ctx, method, req, reply, cc, opts...)
+		}
+	}
+}
+
+// ClientStreamMiddleware gRPC流式调用注入凭证，HMAC签名的内容为空
+func ClientStreamMiddleware(creds ...Credentials) middleware.ClientStreamMiddleware {
+	return func(handler middleware.ClientStreamHandler) middleware.ClientStreamHandler {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx, err := injectOutgoing(ctx, &Request{FullMethod: method}, creds)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, desc, cc, method, opts...)
+		}
+	}
+}
+
+// RPCClientMiddleware 自定义RPC（internal/client）注入凭证，写入 protocol.Request.Meta
+func RPCClientMiddleware(creds ...Credentials) protocol.Middleware {
+	return func(next protocol.HandleFunc) protocol.HandleFunc {
+		return func(ctx context.Context, req *protocol.Request) (*protocol.Response, error) {
+			if req.Meta == nil {
+				req.Meta = make(map[string]string, len(creds))
+			}
+			r := &Request{
+				FullMethod: "/" + req.ServiceName + "/" + req.MethodName,
+				Header:     mapHeader(req.Meta),
+				payload: func() ([]byte, error) {
+					return req.Data, nil
+				},
+			}
+			for _, c := range creds {
+				if err := c.Inject(ctx, r); err != nil {
+					return nil, err
+				}
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// injectOutgoing 不修改调用方的metadata
+func injectOutgoing(ctx context.Context, req *Request, creds []Credentials) (context.Context, error) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	req.Header = mdHeader(md)
+	for _, c := range creds {
+		if err := c.Inject(ctx, req); err != nil {
+			return ctx, err
+		}
+	}
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
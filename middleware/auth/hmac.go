@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"golang.org/x/net/context"
+	"strconv"
+	"time"
+)
+
+const (
+	headerKeyID     = "x-auth-key-id"
+	headerTimestamp = "x-auth-timestamp"
+	headerSignature = "x-auth-signature"
+)
+
+// HMACVerifier 校验HMAC-SHA256签名
+// 签名内容为 方法名\n时间戳\nsha256(请求体)，时间戳为unix秒
+type HMACVerifier struct {
+	// Secrets key id 到密钥
+	Secrets map[string][]byte
+	// Principals key id 对应的调用方，没有配置时subject为key id
+	Principals map[string]*Principal
+	// MaxSkew 时间戳的有效窗口，默认5分钟
+	// 只校验时间戳的新鲜度，窗口内截获的请求仍然可以被重放，需要防重放时应在业务层校验nonce
+	MaxSkew time.Duration
+
+	now func() time.Time
+}
+
+func (v *HMACVerifier) Verify(ctx context.Context, req *Request) (*Principal, error) {
+	keyID := req.Header.Get(headerKeyID)
+	if keyID == "" {
+		return nil, ErrNoCredentials
+	}
+	secret, ok := v.Secrets[keyID]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	ts, err := strconv.ParseInt(req.Header.Get(headerTimestamp), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	skew := v.MaxSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	if d := now().Sub(time.Unix(ts, 0)); d > skew || d < -skew {
+		return nil, ErrInvalidCredentials
+	}
+
+	signature, err := hex.DecodeString(req.Header.Get(headerSignature))
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	expected, err := sign(secret, req, ts)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(signature, expected) {
+		return nil, ErrInvalidCredentials
+	}
+
+	res := &Principal{Subject: keyID, Scheme: "hmac"}
+	if p, ok := v.Principals[keyID]; ok {
+		res.Subject = p.Subject
+		res.Roles = p.Roles
+	}
+	return res, nil
+}
+
+// HMACSigner 客户端用密钥给请求签名
+func HMACSigner(keyID string, secret []byte) Credentials {
+	return &hmacCredentials{keyID: keyID, secret: secret, now: time.Now}
+}
+
+type hmacCredentials struct {
+	keyID  string
+	secret []byte
+	now    func() time.Time
+}
+
+func (c *hmacCredentials) Inject(ctx context.Context, req *Request) error {
+	ts := c.now().Unix()
+	signature, err := sign(c.secret, req, ts)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerKeyID, c.keyID)
+	req.Header.Set(headerTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(headerSignature, hex.EncodeToString(signature))
+	return nil
+}
+
+func sign(secret []byte, req *Request, ts int64) ([]byte, error) {
+	payload, err := req.Payload()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(payload)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(req.FullMethod))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte{'\n'})
+	mac.Write(digest[:])
+	return mac.Sum(nil), nil
+}
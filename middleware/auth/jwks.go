@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk 一个验签的key，RSA公钥或对称密钥
+type jwk struct {
+	kid    string
+	alg    string
+	public *rsa.PublicKey
+	secret []byte
+}
+
+// KeySet 从本地JWKS文件加载验签的key
+// 文件修改后自动重新加载，用于密钥轮换：先把新key加入文件，再用新key签发，最后删除旧key
+type KeySet struct {
+	path     string
+	interval time.Duration
+
+	mutex   sync.RWMutex
+	keys    []*jwk
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// NewKeySet interval为检查文件变化的最小间隔，<=0时默认1分钟
+func NewKeySet(path string, interval time.Duration) (*KeySet, error) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	res := &KeySet{
+		path:     path,
+		interval: interval,
+	}
+	if err := res.reload(0); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// lookup kid为空时返回全部key，由调用方按算法筛选
+// 找不到kid时会提前检查一次文件，新轮换的key不用等到下一个检查周期；
+// 提前检查最多每 interval/10 一次，避免伪造的kid每个请求都触发检查
+func (s *KeySet) lookup(kid string) []*jwk {
+	// 加载失败时继续使用之前的key
+	_ = s.reload(s.interval)
+
+	res := s.find(kid)
+	if len(res) == 0 && kid != "" {
+		_ = s.reload(s.interval / 10)
+		res = s.find(kid)
+	}
+	return res
+}
+
+func (s *KeySet) find(kid string) []*jwk {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if kid == "" {
+		return s.keys
+	}
+	var res []*jwk
+	for _, k := range s.keys {
+		if k.kid == kid {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// reload 距离上次检查不足minInterval时直接返回
+// 绝大多数请求只持有读锁，需要检查文件时才加写锁
+func (s *KeySet) reload(minInterval time.Duration) error {
+	now := time.Now()
+	s.mutex.RLock()
+	fresh := now.Sub(s.checked) < minInterval
+	s.mutex.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 并发的请求已经检查过
+	if now.Sub(s.checked) < minInterval {
+		return nil
+	}
+	s.checked = now
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+func parseJWKS(data []byte) ([]*jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	res := make([]*jwk, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key := &jwk{kid: k.Kid, alg: k.Alg}
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("micro: JWKS key %s 的n格式错误: %w", k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("micro: JWKS key %s 的e格式错误: %w", k.Kid, err)
+			}
+			key.public = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("micro: JWKS key %s 的k格式错误: %w", k.Kid, err)
+			}
+			key.secret = secret
+		default:
+			// 不支持的类型（如EC）跳过
+			continue
+		}
+		res = append(res, key)
+	}
+	if len(res) == 0 {
+		return nil, errors.New("micro: JWKS中没有可用的key")
+	}
+	return res, nil
+}
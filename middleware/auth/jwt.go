@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"golang.org/x/net/context"
+	"strings"
+	"time"
+)
+
+// hashes 支持的算法，不支持none和其他算法
+var hashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256,
+	"HS384": crypto.SHA384,
+	"HS512": crypto.SHA512,
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// JWTVerifier 校验 authorization: Bearer 中的JWT
+// HS256/384/512 使用Secret或JWKS中的oct key，RS256/384/512 使用JWKS中的RSA公钥
+type JWTVerifier struct {
+	Secret []byte
+	Keys   *KeySet
+	// Issuer Audience 不为空时校验iss和aud
+	Issuer   string
+	Audience string
+	// Leeway 校验exp和nbf时允许的时钟偏差
+	Leeway time.Duration
+	// RolesClaim 角色所在的声明，值为字符串数组或空格分隔的字符串，默认roles
+	RolesClaim string
+
+	now func() time.Time
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, req *Request) (*Principal, error) {
+	token := bearer(req.Header)
+	if token == "" {
+		return nil, ErrNoCredentials
+	}
+	claims, err := v.parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	rolesClaim := v.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	return &Principal{
+		Subject: sub,
+		Scheme:  "jwt",
+		Roles:   stringsOf(claims[rolesClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+func (v *JWTVerifier) parse(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCredentials
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidCredentials
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !v.validClaims(claims) {
+		return nil, ErrInvalidCredentials
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) verifySignature(alg, kid, input string, signature []byte) bool {
+	hash, ok := hashes[alg]
+	if !ok {
+		return false
+	}
+	h := hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	var keys []*jwk
+	if v.Keys != nil {
+		keys = v.Keys.lookup(kid)
+	}
+	// 配置了JWKS时，带kid的token只使用kid指定的key
+	if len(v.Secret) > 0 && (kid == "" || v.Keys == nil) {
+		keys = append([]*jwk{{secret: v.Secret}}, keys...)
+	}
+
+	for _, key := range keys {
+		if key.alg != "" && key.alg != alg {
+			continue
+		}
+		switch {
+		case alg[0] == 'H' && key.secret != nil:
+			mac := hmac.New(hash.New, key.secret)
+			mac.Write([]byte(input))
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case alg[0] == 'R' && key.public != nil:
+			if rsa.VerifyPKCS1v15(key.public, hash, digest, signature) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *JWTVerifier) validClaims(claims map[string]interface{}) bool {
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	t := now()
+	if exp, ok := claims["exp"].(float64); ok && t.After(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return false
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && t.Before(time.Unix(int64(nbf), 0).Add(-v.Leeway)) {
+		return false
+	}
+	if v.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.Issuer {
+			return false
+		}
+	}
+	if v.Audience != "" {
+		found := false
+		for _, aud := range stringsOf(claims["aud"]) {
+			if aud == v.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeSegment(seg string, val interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, val)
+}
+
+// stringsOf 字符串数组，或空格分隔的字符串（如OAuth2的scope）
+func stringsOf(val interface{}) []string {
+	switch v := val.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
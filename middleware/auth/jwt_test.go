@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJWTVerifier_HS(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	v := &JWTVerifier{
+		Secret:   secret,
+		Issuer:   "micro",
+		Audience: "user-service",
+		Leeway:   time.Second,
+		now:      func() time.Time { return now },
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+		want    *Principal
+	}{
+		{
+			name:    "no token",
+			wantErr: ErrNoCredentials,
+		},
+		{
+			name: "valid",
+			token: signHS(t, "HS256", "", secret, map[string]interface{}{
+				"sub": "tom", "iss": "micro", "aud": []string{"user-service"}, "exp": now.Unix(), "roles": []string{"admin"},
+			}),
+			want: &Principal{Subject: "tom", Scheme: "jwt", Roles: []string{"admin"}},
+		},
+		{
+			name: "scope string",
+			token: signHS(t, "HS512", "", secret, map[string]interface{}{
+				"sub": "tom", "iss": "micro", "aud": "user-service", "roles": "read write",
+			}),
+			want: &Principal{Subject: "tom", Scheme: "jwt", Roles: []string{"read", "write"}},
+		},
+		{
+			name: "expired",
+			token: signHS(t, "HS256", "", secret, map[string]interface{}{
+				"sub": "tom", "iss": "micro", "aud": "user-service", "exp": now.Add(-2 * time.Second).Unix(),
+			}),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "not before",
+			token: signHS(t, "HS256", "", secret, map[string]interface{}{
+				"sub": "tom", "iss": "micro", "aud": "user-service", "nbf": now.Add(time.Minute).Unix(),
+			}),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "wrong issuer",
+			token: signHS(t, "HS256", "", secret, map[string]interface{}{
+				"sub": "tom", "iss": "other", "aud": "user-service",
+			}),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "wrong audience",
+			token: signHS(t, "HS256", "", secret, map[string]interface{}{
+				"sub": "tom", "iss": "micro", "aud": "order-service",
+			}),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name: "wrong secret",
+			token: signHS(t, "HS256", "", []byte("other"), map[string]interface{}{
+				"sub": "tom", "iss": "micro", "aud": "user-service",
+			}),
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "alg none",
+			token:   segment(t, map[string]string{"alg": "none"}) + "." + segment(t, map[string]string{"sub": "tom"}) + ".",
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "malformed",
+			token:   "abc",
+			wantErr: ErrInvalidCredentials,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := mapHeader{}
+			if tt.token != "" {
+				header["authorization"] = "Bearer " + tt.token
+			}
+			got, err := v.Verify(context.Background(), &Request{Header: header})
+			assert.Equal(t, tt.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tt.want.Subject, got.Subject)
+			assert.Equal(t, tt.want.Scheme, got.Scheme)
+			assert.Equal(t, tt.want.Roles, got.Roles)
+		})
+	}
+}
+
+func TestJWTVerifier_JWKS(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, map[string]*rsa.PrivateKey{"old": oldKey})
+	keys, err := NewKeySet(path, time.Hour)
+	require.NoError(t, err)
+	v := &JWTVerifier{Keys: keys}
+
+	verify := func(token string) error {
+		_, err := v.Verify(context.Background(), &Request{Header: mapHeader{"authorization": "Bearer " + token}})
+		return err
+	}
+	claims := map[string]interface{}{"sub": "tom"}
+	assert.NoError(t, verify(signRS(t, "old", oldKey, claims)))
+	assert.Equal(t, ErrInvalidCredentials, verify(signRS(t, "new", newKey, claims)))
+	// kid指向的key和签名不匹配
+	assert.Equal(t, ErrInvalidCredentials, verify(signRS(t, "old", newKey, claims)))
+
+	// 未知的kid刚触发过检查，限频期间不会重新加载文件
+	writeJWKS(t, path, map[string]*rsa.PrivateKey{"old": oldKey, "new": newKey})
+	assert.Equal(t, ErrInvalidCredentials, verify(signRS(t, "new", newKey, claims)))
+
+	// 轮换：超过 interval/10 后，未知的kid会立即重新加载文件
+	keys.mutex.Lock()
+	keys.checked = time.Now().Add(-keys.interval / 10)
+	keys.mutex.Unlock()
+	assert.NoError(t, verify(signRS(t, "new", newKey, claims)))
+
+	// 删除旧key后，到了检查周期才生效
+	writeJWKS(t, path, map[string]*rsa.PrivateKey{"new": newKey})
+	keys.mutex.Lock()
+	keys.checked = time.Time{}
+	keys.mutex.Unlock()
+	assert.Equal(t, ErrInvalidCredentials, verify(signRS(t, "old", oldKey, claims)))
+	assert.NoError(t, verify(signRS(t, "new", newKey, claims)))
+
+	_, err = NewKeySet(filepath.Join(t.TempDir(), "not-exist.json"), time.Hour)
+	assert.Error(t, err)
+}
+
+func segment(t *testing.T, val interface{}) string {
+	data, err := json.Marshal(val)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS(t *testing.T, alg, kid string, secret []byte, claims map[string]interface{}) string {
+	input := segment(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + segment(t, claims)
+	mac := hmac.New(hashes[alg].New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS(t *testing.T, kid string, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	input := segment(t, map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"}) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, path string, keys map[string]*rsa.PrivateKey) {
+	var set []map[string]string
+	for kid, key := range keys {
+		set = append(set, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(map[string]interface{}{"keys": set})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	// 保证修改时间变化
+	mtime := time.Now().Add(time.Duration(len(keys)) * time.Second)
+	require.NoError(t, os.Chtimes(path, mtime, mtime), fmt.Sprintf("chtimes %s", path))
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// ClientHandler 客户端一元调用的处理函数，与 grpc.UnaryInvoker 一致
+// cc为实际发起调用的连接，集群类的中间件会替换成各个节点的连接
+type ClientHandler func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error
+
+type ClientMiddleware func(handler ClientHandler) ClientHandler
+
+// ClientStreamHandler 客户端流式调用的处理函数，与 grpc.Streamer 一致
+type ClientStreamHandler func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error)
+
+type ClientStreamMiddleware func(handler ClientStreamHandler) ClientStreamHandler
+
+func ChainClient(m ...ClientMiddleware) ClientMiddleware {
+	return func(next ClientHandler) ClientHandler {
+		for i := len(m) - 1; i >= 0; i-- {
+			next = m[i](next)
+		}
+		return next
+	}
+}
+
+func ChainClientStream(m ...ClientStreamMiddleware) ClientStreamMiddleware {
+	return func(next ClientStreamHandler) ClientStreamHandler {
+		for i := len(m) - 1; i >= 0; i-- {
+			next = m[i](next)
+		}
+		return next
+	}
+}
+
+func BuildClientInterceptor(m []ClientMiddleware) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		h := ClientHandler(invoker)
+		if len(m) > 0 {
+			h = ChainClient(m...)(h)
+		}
+		return h(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func BuildClientStreamInterceptor(m []ClientStreamMiddleware) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		h := ClientStreamHandler(streamer)
+		if len(m) > 0 {
+			h = ChainClientStream(m...)(h)
+		}
+		return h(ctx, desc, cc, method, opts...)
+	}
+}
+
+// FromUnaryClientInterceptor 把已有的拦截器（如 cluster/* ）放进同一条中间件链
+func FromUnaryClientInterceptor(interceptor grpc.UnaryClientInterceptor) ClientMiddleware {
+	return func(handler ClientHandler) ClientHandler {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return interceptor(ctx, method, req, reply, cc, grpc.UnaryInvoker(handler), opts...)
+		}
+	}
+}
+
+// FromStreamClientInterceptor 把已有的流式拦截器放进同一条中间件链
+func FromStreamClientInterceptor(interceptor grpc.StreamClientInterceptor) ClientStreamMiddleware {
+	return func(handler ClientStreamHandler) ClientStreamHandler {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return interceptor(ctx, desc, cc, method, grpc.Streamer(handler), opts...)
+		}
+	}
+}
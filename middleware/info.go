@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+// CallInfo 服务端当前调用的信息，由 BuildServerInterceptor / BuildStreamServerInterceptor 放入context
+type CallInfo struct {
+	// FullMethod 完整方法名，如 /users.UserService/GetByID
+	FullMethod string
+	// Service 服务名，如 users.UserService
+	Service string
+	// Method 方法名，如 GetByID
+	Method string
+	// Peer 调用方地址，取不到时为nil
+	Peer net.Addr
+	// Metadata 调用方传过来的metadata
+	Metadata metadata.MD
+	// Deadline 调用的截止时间，HasDeadline为false表示没有设置
+	Deadline    time.Time
+	HasDeadline bool
+	// Stream 是否为流式调用
+	Stream bool
+}
+
+type callInfoKey struct{}
+
+// NewCallInfo 从context和完整方法名构建调用信息
+func NewCallInfo(ctx context.Context, fullMethod string) *CallInfo {
+	service, method := SplitMethod(fullMethod)
+	info := &CallInfo{
+		FullMethod: fullMethod,
+		Service:    service,
+		Method:     method,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		info.Peer = p.Addr
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		info.Metadata = md
+	}
+	info.Deadline, info.HasDeadline = ctx.Deadline()
+	return info
+}
+
+func NewContextWithCallInfo(ctx context.Context, info *CallInfo) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, info)
+}
+
+// CallInfoFromContext 不在服务端中间件链中调用时返回false
+func CallInfoFromContext(ctx context.Context) (*CallInfo, bool) {
+	info, ok := ctx.Value(callInfoKey{}).(*CallInfo)
+	return info, ok
+}
+
+// SplitMethod 把 /users.UserService/GetByID 拆成 users.UserService 和 GetByID
+func SplitMethod(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "", fullMethod
+}
+
+// MatchMethod 判断完整方法名是否匹配任意一个模式
+// 模式按 path.Match 的规则匹配完整方法名，如 /users.UserService/GetByID、/users.UserService/*、/*/Get*
+// 不以/开头的模式按服务名匹配，如 users.UserService、users.*
+func MatchMethod(fullMethod string, patterns ...string) bool {
+	service, _ := SplitMethod(fullMethod)
+	for _, pattern := range patterns {
+		target := fullMethod
+		if !strings.HasPrefix(pattern, "/") {
+			target = service
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ForMethods 只对匹配的方法执行m，其他方法直接调用下一个handler
+// 如 ForMethods(ratelimit.ServerLimiter(limiter), "/users.UserService/GetByID") 只限流一个方法
+func ForMethods(m Middleware, patterns ...string) Middleware {
+	return func(handler Handler) Handler {
+		scoped := m(handler)
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if info, ok := CallInfoFromContext(ctx); ok && MatchMethod(info.FullMethod, patterns...) {
+				return scoped(ctx, req)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// SkipMethods 匹配的方法跳过m，如健康检查不需要鉴权
+func SkipMethods(m Middleware, patterns ...string) Middleware {
+	return func(handler Handler) Handler {
+		scoped := m(handler)
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			if info, ok := CallInfoFromContext(ctx); ok && MatchMethod(info.FullMethod, patterns...) {
+				return handler(ctx, req)
+			}
+			return scoped(ctx, req)
+		}
+	}
+}
+
+// ForStreamMethods 流式调用版本的 ForMethods
+func ForStreamMethods(m StreamMiddleware, patterns ...string) StreamMiddleware {
+	return func(handler StreamHandler) StreamHandler {
+		scoped := m(handler)
+		return func(srv interface{}, stream grpc.ServerStream) error {
+			if info, ok := CallInfoFromContext(stream.Context()); ok && MatchMethod(info.FullMethod, patterns...) {
+				return scoped(srv, stream)
+			}
+			return handler(srv, stream)
+		}
+	}
+}
+
+// SkipStreamMethods 流式调用版本的 SkipMethods
+func SkipStreamMethods(m StreamMiddleware, patterns ...string) StreamMiddleware {
+	return func(handler StreamHandler) StreamHandler {
+		scoped := m(handler)
+		return func(srv interface{}, stream grpc.ServerStream) error {
+			if info, ok := CallInfoFromContext(stream.Context()); ok && MatchMethod(info.FullMethod, patterns...) {
+				return handler(srv, stream)
+			}
+			return scoped(srv, stream)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatchMethod(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{name: "exact", patterns: []string{"/users.UserService/GetByID"}, want: true},
+		{name: "method wildcard", patterns: []string{"/users.UserService/*"}, want: true},
+		{name: "prefix", patterns: []string{"/*/Get*"}, want: true},
+		{name: "service", patterns: []string{"users.UserService"}, want: true},
+		{name: "service wildcard", patterns: []string{"users.*"}, want: true},
+		{name: "other method", patterns: []string{"/users.UserService/Create"}, want: false},
+		{name: "other service", patterns: []string{"orders.OrderService", "/orders.OrderService/*"}, want: false},
+		{name: "any", patterns: []string{"/users.UserService/Create", "users.UserService"}, want: true},
+		{name: "none", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchMethod("/users.UserService/GetByID", tt.patterns...))
+		})
+	}
+}
+
+func TestBuildServerInterceptor_CallInfo(t *testing.T) {
+	var calls []string
+	counter := func(handler Handler) Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			info, _ := CallInfoFromContext(ctx)
+			calls = append(calls, info.Method)
+			return handler(ctx, req)
+		}
+	}
+	interceptor := BuildServerInterceptor([]Middleware{ForMethods(counter, "/users.UserService/Get*")})
+
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("token", "abc"))
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	var got *CallInfo
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got, _ = CallInfoFromContext(ctx)
+		return req, nil
+	}
+	_, err := interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/users.UserService/GetByID"}, handler)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "users.UserService", got.Service)
+	assert.Equal(t, "GetByID", got.Method)
+	assert.Equal(t, addr, got.Peer)
+	assert.Equal(t, []string{"abc"}, got.Metadata.Get("token"))
+	assert.True(t, got.HasDeadline)
+	assert.False(t, got.Stream)
+
+	// 不匹配的方法不经过counter
+	_, err = interceptor(ctx, "req", &grpc.UnaryServerInfo{FullMethod: "/users.UserService/Create"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "Create", got.Method)
+	assert.Equal(t, []string{"GetByID"}, calls)
+}
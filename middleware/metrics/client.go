@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+type ClientMetricsBuilder struct {
+	Namespace string
+	Subsystem string
+	// Registerer 注册指标的位置，默认 prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+	// Buckets 耗时直方图的桶（秒），默认 prometheus.DefBuckets
+	Buckets []float64
+}
+
+func (b *ClientMetricsBuilder) registerer() prometheus.Registerer {
+	if b.Registerer != nil {
+		return b.Registerer
+	}
+	return prometheus.DefaultRegisterer
+}
+
+// Build 按方法和实际调用的节点记录耗时、正在进行的请求数以及状态码
+// target 为实际调用的节点地址，拿不到时使用连接的target
+func (b *ClientMetricsBuilder) Build() grpc.UnaryClientInterceptor {
+	inFlight := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "client_in_flight_requests",
+		Help:      "current-client-request-info",
+		ConstLabels: map[string]string{
+			"component": "client",
+		},
+	}, []string{"method"})
+	inFlight = register(b.registerer(), inFlight).(*prometheus.GaugeVec)
+
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "client_request_duration_seconds",
+		Help:      "client-response-info",
+		Buckets:   b.Buckets,
+		ConstLabels: map[string]string{
+			"component": "client",
+		},
+	}, []string{"method", "target"})
+	duration = register(b.registerer(), duration).(*prometheus.HistogramVec)
+
+	reqCount := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "client_requests_total",
+		Help:      "client-status-info",
+		ConstLabels: map[string]string{
+			"component": "client",
+		},
+	}, []string{"method", "target", "code"})
+	reqCount = register(b.registerer(), reqCount).(*prometheus.CounterVec)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		startTime := time.Now()
+		inFlight.WithLabelValues(method).Add(1)
+
+		var p peer.Peer
+		defer func() {
+			inFlight.WithLabelValues(method).Add(-1)
+
+			target := cc.Target()
+			if p.Addr != nil {
+				target = p.Addr.String()
+			}
+			duration.WithLabelValues(method, target).Observe(time.Since(startTime).Seconds())
+			reqCount.WithLabelValues(method, target, status.Code(err).String()).Add(1)
+		}()
+
+		err = invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		return
+	}
+}
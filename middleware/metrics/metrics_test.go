@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestServerMetricsBuilder_Build(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	b := &ServerMetricsBuilder{Namespace: "micro", Subsystem: "user", Registerer: reg}
+
+	// 重复Build以及同时使用一元和流式不会panic
+	interceptor := b.Build()
+	_ = b.Build()
+	_ = b.BuildStream()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/users.UserService/GetByID"}
+	_, err := interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("mock error")
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]float64{info.FullMethod: 1}, gather(t, reg, "micro_user_error_count", "service"))
+
+	// 不同的Registerer互不影响
+	_ = (&ServerMetricsBuilder{Namespace: "micro", Subsystem: "user", Registerer: prometheus.NewRegistry()}).Build()
+}
+
+func TestClientMetricsBuilder_Build(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	interceptor := (&ClientMetricsBuilder{Namespace: "micro", Registerer: reg}).Build()
+
+	cc, err := grpc.Dial("passthrough:///127.0.0.1:8080", grpc.WithInsecure())
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	method := "/users.UserService/GetByID"
+	invoker := func(code codes.Code) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return status.Error(code, "mock")
+		}
+	}
+	for _, code := range []codes.Code{codes.OK, codes.OK, codes.Unavailable} {
+		_ = interceptor(context.Background(), method, "req", nil, cc, invoker(code))
+	}
+
+	assert.Equal(t, map[string]float64{"OK": 2, "Unavailable": 1}, gather(t, reg, "micro_client_requests_total", "code"))
+	assert.Equal(t, map[string]float64{"passthrough:///127.0.0.1:8080": 3}, gather(t, reg, "micro_client_requests_total", "target"))
+	assert.Equal(t, map[string]float64{method: 0}, gather(t, reg, "micro_client_in_flight_requests", "method"))
+}
+
+// gather 按label汇总指标的值，直方图取样本数
+func gather(t *testing.T, reg *prometheus.Registry, name, label string) map[string]float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	res := make(map[string]float64)
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() != label {
+					continue
+				}
+				switch {
+				case m.Counter != nil:
+					res[l.GetValue()] += m.GetCounter().GetValue()
+				case m.Gauge != nil:
+					res[l.GetValue()] += m.GetGauge().GetValue()
+				case m.Histogram != nil:
+					res[l.GetValue()] += float64(m.GetHistogram().GetSampleCount())
+				}
+			}
+		}
+	}
+	return res
+}
@@ -2,50 +2,60 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	_ "github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"micro/middleware"
 	"time"
 )
 
 type ServerMetricsBuilder struct {
 	Namespace string
 	Subsystem string
+	// Registerer 注册指标的位置，默认 prometheus.DefaultRegisterer
+	// 同一进程内多个服务端使用不同的Registerer或Namespace/Subsystem避免冲突
+	Registerer prometheus.Registerer
+}
+
+func (b *ServerMetricsBuilder) registerer() prometheus.Registerer {
+	if b.Registerer != nil {
+		return b.Registerer
+	}
+	return prometheus.DefaultRegisterer
 }
 
 func (b *ServerMetricsBuilder) Build() grpc.UnaryServerInterceptor {
 	reqCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: b.Namespace,
 		Subsystem: b.Subsystem,
-		Name:      "active-request-count",
+		Name:      "active_request_count",
 		Help:      "current-request-info",
 		ConstLabels: map[string]string{
 			"component": "server",
 		},
 	}, []string{"service"})
-	prometheus.MustRegister(reqCount)
+	reqCount = register(b.registerer(), reqCount).(*prometheus.GaugeVec)
 
 	response := prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace: b.Namespace,
 		Subsystem: b.Subsystem,
-		Name:      "response-info",
+		Name:      "response_info",
 		Help:      "current-response-info",
 		ConstLabels: map[string]string{
 			"component": "server",
 		},
 	}, []string{"service"})
-	prometheus.MustRegister(response)
+	response = register(b.registerer(), response).(*prometheus.SummaryVec)
 
 	errCount := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: b.Namespace,
 		Subsystem: b.Subsystem,
-		Name:      "response-info",
+		Name:      "error_count",
 		Help:      "current-error-info",
 		ConstLabels: map[string]string{
 			"component": "server",
 		},
 	}, []string{"service"})
-	prometheus.MustRegister(errCount)
+	errCount = register(b.registerer(), errCount).(*prometheus.CounterVec)
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 		startTime := time.Now()
@@ -67,3 +77,79 @@ func (b *ServerMetricsBuilder) Build() grpc.UnaryServerInterceptor {
 		return
 	}
 }
+
+// BuildStream 流式调用的指标，除了调用次数和耗时外还记录收发的消息数
+func (b *ServerMetricsBuilder) BuildStream() grpc.StreamServerInterceptor {
+	streamCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "active_stream_count",
+		Help:      "current-stream-info",
+		ConstLabels: map[string]string{
+			"component": "server",
+		},
+	}, []string{"service"})
+	streamCount = register(b.registerer(), streamCount).(*prometheus.GaugeVec)
+
+	response := prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "stream_response_info",
+		Help:      "current-stream-response-info",
+		ConstLabels: map[string]string{
+			"component": "server",
+		},
+	}, []string{"service"})
+	response = register(b.registerer(), response).(*prometheus.SummaryVec)
+
+	errCount := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "stream_error_count",
+		Help:      "current-stream-error-info",
+		ConstLabels: map[string]string{
+			"component": "server",
+		},
+	}, []string{"service"})
+	errCount = register(b.registerer(), errCount).(*prometheus.CounterVec)
+
+	msgCount := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: b.Namespace,
+		Subsystem: b.Subsystem,
+		Name:      "stream_msg_count",
+		Help:      "stream-message-info",
+		ConstLabels: map[string]string{
+			"component": "server",
+		},
+	}, []string{"service", "type"})
+	msgCount = register(b.registerer(), msgCount).(*prometheus.CounterVec)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		startTime := time.Now()
+
+		streamCount.WithLabelValues(info.FullMethod).Add(1)
+		defer func() {
+			streamCount.WithLabelValues(info.FullMethod).Add(-1)
+			if err != nil {
+				errCount.WithLabelValues(info.FullMethod).Add(1)
+			}
+
+			response.WithLabelValues(info.FullMethod).Observe(float64(time.Now().Sub(startTime).Milliseconds()))
+		}()
+
+		stream := middleware.WrapServerStream(ss)
+		stream.OnRecv = func(msg interface{}, err error) {
+			if err == nil {
+				msgCount.WithLabelValues(info.FullMethod, "received").Add(1)
+			}
+		}
+		stream.OnSend = func(msg interface{}, err error) {
+			if err == nil {
+				msgCount.WithLabelValues(info.FullMethod, "sent").Add(1)
+			}
+		}
+
+		err = handler(srv, stream)
+		return
+	}
+}
@@ -27,6 +27,7 @@ func BuildServerInterceptor(m []Middleware) grpc.UnaryServerInterceptor {
 		if len(m) > 0 {
 			h = Chain(m...)(h)
 		}
+		ctx = NewContextWithCallInfo(ctx, NewCallInfo(ctx, info.FullMethod))
 		reply, err := h(ctx, req)
 		return reply, err
 	}
@@ -0,0 +1,67 @@
+package recovery
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"micro/middleware"
+	"runtime/debug"
+)
+
+// ErrPanic 返回给调用方的错误，不暴露panic的具体内容
+var ErrPanic = status.Error(codes.Internal, "micro: 服务端内部错误")
+
+// PanicHandler 发生panic时回调，用于打日志或上报指标
+// ctx中可以用 middleware.CallInfoFromContext 取到调用的方法
+type PanicHandler func(ctx context.Context, p interface{}, stack []byte)
+
+type RecoveryBuilder struct {
+	// OnPanic 默认用log打印panic和调用栈
+	OnPanic PanicHandler
+}
+
+func (b *RecoveryBuilder) onPanic(ctx context.Context, p interface{}) {
+	stack := debug.Stack()
+	if b.OnPanic != nil {
+		b.OnPanic(ctx, p, stack)
+		return
+	}
+	method := ""
+	if info, ok := middleware.CallInfoFromContext(ctx); ok {
+		method = info.FullMethod
+	}
+	log.Printf("micro: %s panic: %v\n%s", method, p, stack)
+}
+
+// Build 放在中间件链的最前面，才能捕获后面所有中间件的panic
+func (b *RecoveryBuilder) Build() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					b.onPanic(ctx, p)
+					reply, err = nil, ErrPanic
+				}
+			}()
+			reply, err = handler(ctx, req)
+			return
+		}
+	}
+}
+
+func (b *RecoveryBuilder) BuildStream() middleware.StreamMiddleware {
+	return func(handler middleware.StreamHandler) middleware.StreamHandler {
+		return func(srv interface{}, stream grpc.ServerStream) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					b.onPanic(stream.Context(), p)
+					err = ErrPanic
+				}
+			}()
+			err = handler(srv, stream)
+			return
+		}
+	}
+}
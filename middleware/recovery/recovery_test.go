@@ -0,0 +1,64 @@
+package recovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"micro/middleware"
+	"testing"
+)
+
+func TestRecoveryBuilder_Build(t *testing.T) {
+	var method string
+	var got interface{}
+	b := &RecoveryBuilder{OnPanic: func(ctx context.Context, p interface{}, stack []byte) {
+		info, _ := middleware.CallInfoFromContext(ctx)
+		method = info.FullMethod
+		got = p
+		assert.NotEmpty(t, stack)
+	}}
+	interceptor := middleware.BuildServerInterceptor([]middleware.Middleware{b.Build()})
+	info := &grpc.UnaryServerInfo{FullMethod: "/users.UserService/GetByID"}
+
+	reply, err := interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		var m map[string]string
+		m["key"] = "value"
+		return "reply", nil
+	})
+	assert.Nil(t, reply)
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "/users.UserService/GetByID", method)
+	assert.NotNil(t, got)
+
+	// 没有panic时不影响结果
+	reply, err = interceptor(context.Background(), "req", info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "reply", reply)
+}
+
+func TestRecoveryBuilder_BuildStream(t *testing.T) {
+	called := false
+	b := &RecoveryBuilder{OnPanic: func(ctx context.Context, p interface{}, stack []byte) {
+		called = true
+		assert.Equal(t, "stream panic", p)
+	}}
+	interceptor := middleware.BuildStreamServerInterceptor([]middleware.StreamMiddleware{b.BuildStream()})
+	err := interceptor(nil, &mockServerStream{}, &grpc.StreamServerInfo{FullMethod: "/test/Echo"}, func(srv interface{}, stream grpc.ServerStream) error {
+		panic("stream panic")
+	})
+	assert.Equal(t, ErrPanic, err)
+	assert.True(t, called)
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return context.Background()
+}
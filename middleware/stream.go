@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// StreamHandler 流式调用的处理函数，与 grpc.StreamHandler 一致
+// 需要修改context时，用 WrapServerStream 包装stream后设置 Ctx
+type StreamHandler func(srv interface{}, stream grpc.ServerStream) error
+
+type StreamMiddleware func(handler StreamHandler) StreamHandler
+
+func ChainStream(m ...StreamMiddleware) StreamMiddleware {
+	return func(next StreamHandler) StreamHandler {
+		for i := len(m) - 1; i >= 0; i-- {
+			next = m[i](next)
+		}
+		return next
+	}
+}
+
+func BuildStreamServerInterceptor(m []StreamMiddleware) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		h := func(srv interface{}, stream grpc.ServerStream) error {
+			return handler(srv, stream)
+		}
+
+		if len(m) > 0 {
+			h = ChainStream(m...)(h)
+		}
+		callInfo := NewCallInfo(ss.Context(), info.FullMethod)
+		callInfo.Stream = true
+		stream := WrapServerStream(ss)
+		stream.Ctx = NewContextWithCallInfo(ss.Context(), callInfo)
+		return h(srv, stream)
+	}
+}
+
+// ServerStream 包装 grpc.ServerStream，可以替换context，以及在每条消息收发后回调
+type ServerStream struct {
+	grpc.ServerStream
+
+	// Ctx 不为nil时替换原来的context
+	Ctx context.Context
+
+	// OnRecv 每次RecvMsg之后回调，err为io.EOF表示客户端已发送完毕
+	OnRecv func(msg interface{}, err error)
+
+	// OnSend 每次SendMsg之后回调
+	OnSend func(msg interface{}, err error)
+}
+
+// WrapServerStream 每层中间件各自包装，回调互不覆盖
+func WrapServerStream(stream grpc.ServerStream) *ServerStream {
+	return &ServerStream{
+		ServerStream: stream,
+		Ctx:          stream.Context(),
+	}
+}
+
+func (s *ServerStream) Context() context.Context {
+	if s.Ctx != nil {
+		return s.Ctx
+	}
+	return s.ServerStream.Context()
+}
+
+func (s *ServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if s.OnRecv != nil {
+		s.OnRecv(m, err)
+	}
+	return err
+}
+
+func (s *ServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if s.OnSend != nil {
+		s.OnSend(m, err)
+	}
+	return err
+}
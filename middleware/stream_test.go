@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"io"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestBuildStreamServerInterceptor(t *testing.T) {
+	var order []string
+	var received, sent []interface{}
+
+	first := func(handler StreamHandler) StreamHandler {
+		return func(srv interface{}, stream grpc.ServerStream) error {
+			order = append(order, "first")
+			ss := WrapServerStream(stream)
+			ss.Ctx = context.WithValue(stream.Context(), ctxKey{}, "value")
+			ss.OnRecv = func(msg interface{}, err error) {
+				if err == nil {
+					received = append(received, msg)
+				}
+			}
+			return handler(srv, ss)
+		}
+	}
+	second := func(handler StreamHandler) StreamHandler {
+		return func(srv interface{}, stream grpc.ServerStream) error {
+			order = append(order, "second")
+			ss := WrapServerStream(stream)
+			ss.OnSend = func(msg interface{}, err error) {
+				sent = append(sent, msg)
+			}
+			return handler(srv, ss)
+		}
+	}
+
+	interceptor := BuildStreamServerInterceptor([]StreamMiddleware{first, second})
+	stream := &mockServerStream{ctx: context.Background(), msgs: []string{"a", "b"}}
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/test/Echo"}, func(srv interface{}, ss grpc.ServerStream) error {
+		assert.Equal(t, "value", ss.Context().Value(ctxKey{}))
+		for {
+			var msg string
+			if err := ss.RecvMsg(&msg); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := ss.SendMsg(msg); err != nil {
+				return err
+			}
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, order)
+	assert.Len(t, received, 2)
+	assert.Equal(t, []interface{}{"a", "b"}, sent)
+	assert.Equal(t, []string{"a", "b"}, stream.sent)
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	msgs []string
+	sent []string
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return m.ctx
+}
+
+func (m *mockServerStream) RecvMsg(msg interface{}) error {
+	if len(m.msgs) == 0 {
+		return io.EOF
+	}
+	*(msg.(*string)) = m.msgs[0]
+	m.msgs = m.msgs[1:]
+	return nil
+}
+
+func (m *mockServerStream) SendMsg(msg interface{}) error {
+	m.sent = append(m.sent, msg.(string))
+	return nil
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"google.golang.org/grpc/status"
+	"micro/middleware"
+	"net"
+	"strconv"
+)
+
+// methodAttributes rpc.system、rpc.service、rpc.method
+func methodAttributes(fullMethod string) []attribute.KeyValue {
+	service, method := middleware.SplitMethod(fullMethod)
+	return []attribute.KeyValue{
+		semconv.RPCSystemGRPC,
+		semconv.RPCService(service),
+		semconv.RPCMethod(method),
+	}
+}
+
+// peerAttributes 对端的 net.sock.peer.addr 和 net.sock.peer.port
+func peerAttributes(addr net.Addr) []attribute.KeyValue {
+	if addr == nil {
+		return nil
+	}
+	host, port := splitHostPort(addr.String())
+	res := []attribute.KeyValue{semconv.NetSockPeerAddr(host)}
+	if port > 0 {
+		res = append(res, semconv.NetSockPeerPort(port))
+	}
+	return res
+}
+
+// hostAttributes 本机的 net.host.name 和 net.host.port
+func hostAttributes(host string, port int) []attribute.KeyValue {
+	var res []attribute.KeyValue
+	if host != "" {
+		res = append(res, semconv.NetHostName(host))
+	}
+	if port > 0 {
+		res = append(res, semconv.NetHostPort(port))
+	}
+	return res
+}
+
+func statusAttribute(err error) attribute.KeyValue {
+	return semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err)))
+}
+
+// splitHostPort 没有端口时port为0
+func splitHostPort(addr string) (string, int) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return host, 0
+	}
+	return host, port
+}
+
+// GetOutboundIP 遍历网卡，返回第一个可用的非回环地址，优先IPv4；都没有时返回空字符串
+// 不依赖外部网络，离线环境也可以使用
+func GetOutboundIP() string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	var ipv6 string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if ip := ipNet.IP.To4(); ip != nil {
+				return ip.String()
+			}
+			if ipv6 == "" {
+				ipv6 = ipNet.IP.String()
+			}
+		}
+	}
+	return ipv6
+}
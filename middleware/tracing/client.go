@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"io"
+	"sync"
+)
+
+type ClientTracingBuilder struct {
+	Tracer trace.Tracer
+}
+
+// Build 每次调用一个client span，并通过metadata把trace信息传给服务端
+func (b *ClientTracingBuilder) Build() grpc.UnaryClientInterceptor {
+	if b.Tracer == nil {
+		b.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		spanCtx, span := b.Tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(methodAttributes(method)...))
+
+		var p peer.Peer
+		defer func() {
+			end(span, &p, err)
+		}()
+
+		err = invoker(inject(spanCtx), method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		return
+	}
+}
+
+// BuildStream 整个流是一个span，流结束（收到io.EOF或出错）时结束span
+// 调用方取消context或提前停止读取并取消时，以context的错误结束span
+func (b *ClientTracingBuilder) BuildStream() grpc.StreamClientInterceptor {
+	if b.Tracer == nil {
+		b.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
+	}
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		spanCtx, span := b.Tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(methodAttributes(method)...))
+
+		p := &peer.Peer{}
+		cs, err := streamer(inject(spanCtx), desc, cc, method, append(opts, grpc.Peer(p))...)
+		if err != nil {
+			end(span, p, err)
+			return nil, err
+		}
+		stream := &clientStream{ClientStream: cs, span: span, peer: p, serverStreams: desc.ServerStreams, done: make(chan struct{})}
+		// 监听调用方的context，grpc在流正常结束时也会取消 cs.Context()，不能用来判断
+		go func() {
+			select {
+			case <-ctx.Done():
+				stream.finish(status.FromContextError(ctx.Err()).Err())
+			case <-stream.done:
+			}
+		}()
+		return stream, nil
+	}
+}
+
+// inject 把当前span写入outgoing metadata，不修改调用方的metadata
+func inject(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, MetadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// end 记录状态码和对端地址后结束span
+func end(span trace.Span, p *peer.Peer, err error) {
+	span.SetAttributes(statusAttribute(err))
+	span.SetAttributes(peerAttributes(p.Addr)...)
+	// recode error
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	span trace.Span
+	peer *peer.Peer
+	once sync.Once
+	// done span结束后关闭
+	done chan struct{}
+	// serverStreams 为false时服务端只返回一条消息，收到即结束
+	serverStreams bool
+
+	// received 和 sent 只在各自的goroutine中修改
+	received int
+	sent     int
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.finish(nil)
+	case err != nil:
+		s.finish(err)
+	default:
+		s.received++
+		s.span.AddEvent("message", trace.WithAttributes(
+			attribute.String("message.type", "RECEIVED"),
+			attribute.Int("message.id", s.received),
+		))
+		if !s.serverStreams {
+			s.finish(nil)
+		}
+	}
+	return err
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil {
+		// io.EOF 表示流已经结束，真正的错误由RecvMsg返回
+		if err != io.EOF {
+			s.finish(err)
+		}
+		return err
+	}
+	s.sent++
+	s.span.AddEvent("message", trace.WithAttributes(
+		attribute.String("message.type", "SENT"),
+		attribute.Int("message.id", s.sent),
+	))
+	return nil
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		end(s.span, s.peer, err)
+		close(s.done)
+	})
+}
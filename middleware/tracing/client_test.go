@@ -0,0 +1,109 @@
+package tracing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"testing"
+	"time"
+)
+
+func TestClientTracingBuilder_Propagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), parent)
+	ctx = metadata.AppendToOutgoingContext(ctx, "user", "tom")
+
+	client := (&ClientTracingBuilder{}).Build()
+	server := (&ServerTracingBuilder{}).Build()
+
+	var got trace.SpanContext
+	var user []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		// 模拟网络传输：outgoing metadata 变成服务端的 incoming metadata
+		md, _ := metadata.FromOutgoingContext(ctx)
+		serverCtx := metadata.NewIncomingContext(context.Background(), md)
+		_, err := server(serverCtx, req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			got = trace.SpanContextFromContext(ctx)
+			user = metadata.ValueFromIncomingContext(ctx, "user")
+			return nil, nil
+		})
+		return err
+	}
+
+	err := client(ctx, "/users.UserService/GetByID", "req", nil, nil, invoker)
+	require.NoError(t, err)
+	assert.Equal(t, parent.TraceID(), got.TraceID())
+	assert.Equal(t, []string{"tom"}, user)
+
+	// 调用方的metadata没有被修改
+	md, _ := metadata.FromOutgoingContext(ctx)
+	assert.Empty(t, md.Get("traceparent"))
+}
+
+func TestMetadataCarrier(t *testing.T) {
+	md := metadata.MD{}
+	carrier := MetadataCarrier(md)
+	carrier.Set("Traceparent", "value")
+	assert.Equal(t, "value", carrier.Get("traceparent"))
+	assert.Equal(t, []string{"traceparent"}, carrier.Keys())
+	assert.Equal(t, "", carrier.Get("tracestate"))
+}
+
+// recordTracer 记录span结束时的状态
+type recordTracer struct {
+	trace.Tracer
+	span *recordSpan
+}
+
+func (r *recordTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	r.span = &recordSpan{Span: trace.SpanFromContext(context.Background()), ended: make(chan struct{})}
+	return trace.ContextWithSpan(ctx, r.span), r.span
+}
+
+type recordSpan struct {
+	trace.Span
+	ended chan struct{}
+	code  codes.Code
+}
+
+func (s *recordSpan) SetStatus(code codes.Code, description string) {
+	s.code = code
+}
+
+func (s *recordSpan) End(options ...trace.SpanEndOption) {
+	close(s.ended)
+}
+
+func TestClientTracingBuilder_StreamCanceled(t *testing.T) {
+	tracer := &recordTracer{}
+	interceptor := (&ClientTracingBuilder{Tracer: tracer}).BuildStream()
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := interceptor(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/users.UserService/List", streamer)
+	require.NoError(t, err)
+
+	// 调用方没有读完就取消，span也要结束
+	cancel()
+	select {
+	case <-tracer.span.ended:
+	case <-time.After(time.Second):
+		t.Fatal("span没有结束")
+	}
+	assert.Equal(t, codes.Error, tracer.span.code)
+}
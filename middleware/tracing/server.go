@@ -1,23 +1,38 @@
 package tracing
 
 import (
-	"fmt"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
-	"net"
+	"google.golang.org/grpc/peer"
+	"micro/middleware"
 )
 
 const instrumentationName = "github.com/Tini-Bytes/micro/tracing"
 
 type ServerTracingBuilder struct {
 	Tracer trace.Tracer
-	Port   int
+	// Addr 本机对外的地址，如 10.0.0.1:8080，优先级最高。
+	// micro.Server 的拦截器在 Start 监听之前就已创建，拿不到监听地址，需要在这里显式设置
+	Addr string
+	// Port 没有设置Addr或者Addr里没有端口时使用，没有设置Addr时IP从网卡中取
+	Port int
+}
+
+// hostAddr 按 Addr、网卡 的顺序确定本机地址
+func (b *ServerTracingBuilder) hostAddr() (string, int) {
+	if b.Addr != "" {
+		host, port := splitHostPort(b.Addr)
+		if port == 0 {
+			port = b.Port
+		}
+		return host, port
+	}
+	return GetOutboundIP(), b.Port
 }
 
 func (b *ServerTracingBuilder) Build() grpc.UnaryServerInterceptor {
@@ -25,17 +40,19 @@ func (b *ServerTracingBuilder) Build() grpc.UnaryServerInterceptor {
 		b.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
 	}
 
-	addr := GetOutboundIP()
-	if b.Port != 0 {
-		addr = fmt.Sprintf("%s:%d", addr, b.Port)
-	}
+	host := hostAttributes(b.hostAddr())
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 		ctx = b.extract(ctx)
 		spanCtx, span := b.Tracer.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
-		span.SetAttributes(attribute.String("addr", addr))
+		span.SetAttributes(methodAttributes(info.FullMethod)...)
+		span.SetAttributes(host...)
+		if p, ok := peer.FromContext(ctx); ok {
+			span.SetAttributes(peerAttributes(p.Addr)...)
+		}
 
 		defer func() {
+			span.SetAttributes(statusAttribute(err))
 			// recode error
 			if err != nil {
 				span.SetStatus(codes.Error, err.Error())
@@ -49,23 +66,66 @@ func (b *ServerTracingBuilder) Build() grpc.UnaryServerInterceptor {
 	}
 }
 
+// BuildStream 整个流是一个span，每条收发的消息记录为span上的事件
+func (b *ServerTracingBuilder) BuildStream() grpc.StreamServerInterceptor {
+	if b.Tracer == nil {
+		b.Tracer = otel.GetTracerProvider().Tracer(instrumentationName)
+	}
+
+	host := hostAttributes(b.hostAddr())
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := b.extract(ss.Context())
+		spanCtx, span := b.Tracer.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+		span.SetAttributes(methodAttributes(info.FullMethod)...)
+		span.SetAttributes(host...)
+		if p, ok := peer.FromContext(ctx); ok {
+			span.SetAttributes(peerAttributes(p.Addr)...)
+		}
+
+		defer func() {
+			span.SetAttributes(statusAttribute(err))
+			// recode error
+			if err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				span.RecordError(err)
+			}
+			span.End()
+		}()
+
+		var received, sent int
+		stream := middleware.WrapServerStream(ss)
+		stream.Ctx = spanCtx
+		stream.OnRecv = func(msg interface{}, err error) {
+			if err != nil {
+				return
+			}
+			received++
+			span.AddEvent("message", trace.WithAttributes(
+				attribute.String("message.type", "RECEIVED"),
+				attribute.Int("message.id", received),
+			))
+		}
+		stream.OnSend = func(msg interface{}, err error) {
+			if err != nil {
+				return
+			}
+			sent++
+			span.AddEvent("message", trace.WithAttributes(
+				attribute.String("message.type", "SENT"),
+				attribute.Int("message.id", sent),
+			))
+		}
+
+		err = handler(srv, stream)
+		return
+	}
+}
+
 func (b *ServerTracingBuilder) extract(ctx context.Context) context.Context {
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		md = metadata.MD{}
 	}
-	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(md))
-}
-
-func GetOutboundIP() string {
-	// ping DNS
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return ""
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-	addr := conn.LocalAddr().(*net.UDPAddr)
-	return addr.String()
+	return otel.GetTextMapPropagator().Extract(ctx, MetadataCarrier(md))
 }
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"net"
+	"testing"
+)
+
+func TestServerTracingBuilder_hostAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		b        *ServerTracingBuilder
+		wantHost string
+		wantPort int
+	}{
+		{
+			name:     "addr",
+			b:        &ServerTracingBuilder{Addr: "10.0.0.1:8080", Port: 9090},
+			wantHost: "10.0.0.1",
+			wantPort: 8080,
+		},
+		{
+			name:     "addr without port",
+			b:        &ServerTracingBuilder{Addr: "10.0.0.1", Port: 9090},
+			wantHost: "10.0.0.1",
+			wantPort: 9090,
+		},
+		{
+			name:     "interface",
+			b:        &ServerTracingBuilder{Port: 9090},
+			wantHost: GetOutboundIP(),
+			wantPort: 9090,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port := tt.b.hostAddr()
+			assert.Equal(t, tt.wantHost, host)
+			assert.Equal(t, tt.wantPort, port)
+		})
+	}
+}
+
+func TestGetOutboundIP(t *testing.T) {
+	ip := GetOutboundIP()
+	if ip == "" {
+		t.Skip("没有可用的网卡地址")
+	}
+	parsed := net.ParseIP(ip)
+	require.NotNil(t, parsed)
+	assert.False(t, parsed.IsLoopback())
+}
+
+func TestAttributes(t *testing.T) {
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", "users.UserService"),
+		attribute.String("rpc.method", "GetByID"),
+	}, methodAttributes("/users.UserService/GetByID"))
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("net.sock.peer.addr", "10.0.0.2"),
+		attribute.Int("net.sock.peer.port", 51234),
+	}, peerAttributes(&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 51234}))
+	assert.Nil(t, peerAttributes(nil))
+	assert.Equal(t, attribute.Int("rpc.grpc.status_code", 0), statusAttribute(nil))
+}
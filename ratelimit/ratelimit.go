@@ -5,6 +5,7 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"micro/middleware"
+	"sync"
 )
 
 type Limiter interface {
@@ -17,6 +18,11 @@ func NewServerLimiter(limiter Limiter) grpc.ServerOption {
 	return grpc.UnaryInterceptor(interceptor)
 }
 
+func NewServerStreamLimiter(limiter Limiter) grpc.ServerOption {
+	interceptor := BuildStreamServerInterceptor(limiter)
+	return grpc.StreamInterceptor(interceptor)
+}
+
 func NewClientLimiter(limiter Limiter) grpc.DialOption {
 	interceptor := BuildClientInterceptor(limiter)
 	return grpc.WithUnaryInterceptor(interceptor)
@@ -34,6 +40,34 @@ func ServerLimiter(limiter Limiter) middleware.Middleware {
 	}
 }
 
+// ServerMethodLimiter 每个方法单独限流，第一次调用某个方法时用newLimiter创建该方法的限流器
+// 只限流部分方法时配合 middleware.ForMethods 使用
+func ServerMethodLimiter(newLimiter func(fullMethod string) Limiter) middleware.Middleware {
+	var mutex sync.Mutex
+	limiters := make(map[string]Limiter, 8)
+	get := func(fullMethod string) Limiter {
+		mutex.Lock()
+		defer mutex.Unlock()
+		limiter, ok := limiters[fullMethod]
+		if !ok {
+			limiter = newLimiter(fullMethod)
+			limiters[fullMethod] = limiter
+		}
+		return limiter
+	}
+
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, info interface{}) (reply interface{}, err error) {
+			call, ok := middleware.CallInfoFromContext(ctx)
+			if ok && !get(call.FullMethod).Allow() {
+				return nil, errors.New("rate-limit")
+			}
+			reply, err = handler(ctx, info)
+			return
+		}
+	}
+}
+
 func BuildServerInterceptor(limiter Limiter) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 		if !limiter.Allow() {
@@ -44,6 +78,38 @@ func BuildServerInterceptor(limiter Limiter) grpc.UnaryServerInterceptor {
 	}
 }
 
+// ServerStreamLimiter 流式调用的限流，只在建立流时判断一次
+func ServerStreamLimiter(limiter Limiter) middleware.StreamMiddleware {
+	return func(handler middleware.StreamHandler) middleware.StreamHandler {
+		return func(srv interface{}, stream grpc.ServerStream) error {
+			if !limiter.Allow() {
+				return errors.New("rate-limit")
+			}
+			return handler(srv, stream)
+		}
+	}
+}
+
+func BuildStreamServerInterceptor(limiter Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !limiter.Allow() {
+			return errors.New("rate-limit")
+		}
+		return handler(srv, ss)
+	}
+}
+
+func ClientLimiter(limiter Limiter) middleware.ClientMiddleware {
+	return func(handler middleware.ClientHandler) middleware.ClientHandler {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			if !limiter.Allow() {
+				return errors.New("rate-limit")
+			}
+			return handler(ctx, method, req, reply, cc, opts...)
+		}
+	}
+}
+
 func BuildClientInterceptor(limiter Limiter) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
 		if !limiter.Allow() {
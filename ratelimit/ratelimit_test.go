@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"micro/middleware"
+	"testing"
+)
+
+// countLimiter 前limit次放行，之后全部拒绝
+type countLimiter struct {
+	limit   int
+	allowed int
+}
+
+func (l *countLimiter) Allow() bool {
+	if l.allowed >= l.limit {
+		return false
+	}
+	l.allowed++
+	return true
+}
+
+func (l *countLimiter) Close() {}
+
+type mockServerStream struct {
+	grpc.ServerStream
+}
+
+func (m *mockServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func TestServerStreamLimiter(t *testing.T) {
+	var calls int
+	handler := ServerStreamLimiter(&countLimiter{limit: 1})(func(srv interface{}, stream grpc.ServerStream) error {
+		calls++
+		return nil
+	})
+
+	require.NoError(t, handler(nil, &mockServerStream{}))
+	// 超过限制后不再调用handler
+	assert.EqualError(t, handler(nil, &mockServerStream{}), "rate-limit")
+	assert.Equal(t, 1, calls)
+}
+
+func TestBuildStreamServerInterceptor(t *testing.T) {
+	var calls int
+	interceptor := BuildStreamServerInterceptor(&countLimiter{limit: 2})
+	info := &grpc.StreamServerInfo{FullMethod: "/users.UserService/Watch"}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		calls++
+		return nil
+	}
+
+	require.NoError(t, interceptor(nil, &mockServerStream{}, info, handler))
+	require.NoError(t, interceptor(nil, &mockServerStream{}, info, handler))
+	assert.EqualError(t, interceptor(nil, &mockServerStream{}, info, handler), "rate-limit")
+	assert.Equal(t, 2, calls)
+}
+
+func TestServerMethodLimiter(t *testing.T) {
+	created := make(map[string]int)
+	limiter := ServerMethodLimiter(func(fullMethod string) Limiter {
+		created[fullMethod]++
+		return &countLimiter{limit: 1}
+	})
+	interceptor := middleware.BuildServerInterceptor([]middleware.Middleware{limiter})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	}
+	get := &grpc.UnaryServerInfo{FullMethod: "/users.UserService/GetByID"}
+	create := &grpc.UnaryServerInfo{FullMethod: "/users.UserService/Create"}
+
+	_, err := interceptor(context.Background(), "req", get, handler)
+	require.NoError(t, err)
+	_, err = interceptor(context.Background(), "req", get, handler)
+	assert.EqualError(t, err, "rate-limit")
+
+	// 每个方法有自己的限流器，互不影响
+	_, err = interceptor(context.Background(), "req", create, handler)
+	require.NoError(t, err)
+	_, err = interceptor(context.Background(), "req", create, handler)
+	assert.EqualError(t, err, "rate-limit")
+
+	// 限流器只在第一次调用时创建
+	assert.Equal(t, map[string]int{get.FullMethod: 1, create.FullMethod: 1}, created)
+
+	// 不在中间件链中调用时拿不到方法名，不限流
+	direct := limiter(handler)
+	for i := 0; i < 3; i++ {
+		_, err = direct(context.Background(), "req")
+		require.NoError(t, err)
+	}
+}
+
+func TestClientLimiter(t *testing.T) {
+	var calls int
+	interceptor := middleware.BuildClientInterceptor([]middleware.ClientMiddleware{ClientLimiter(&countLimiter{limit: 1})})
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return nil
+	}
+
+	method := "/users.UserService/GetByID"
+	require.NoError(t, interceptor(context.Background(), method, "req", nil, nil, invoker))
+	// 超过限制后请求不会发出去
+	assert.EqualError(t, interceptor(context.Background(), method, "req", nil, nil, invoker), "rate-limit")
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"google.golang.org/grpc/attributes"
+)
+
+// resolver.Address.Attributes 中的key，由 micro.RegistryResolver 写入
+const (
+	AttributeGroup   = "group"
+	AttributeWeight  = "weight"
+	AttributeVersion = "version"
+	AttributeZone    = "zone"
+	AttributeTags    = "tags"
+	AttributeMeta    = "meta"
+)
+
+// DefaultWeight 未设置权重时的默认权重
+const DefaultWeight uint32 = 10
+
+// Tags 实例标签，实现Equal以便作为grpc的attribute值
+type Tags []string
+
+func (t Tags) Equal(o interface{}) bool {
+	other, ok := o.(Tags)
+	if !ok || len(t) != len(other) {
+		return false
+	}
+	for i := range t {
+		if t[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Tags) Contains(tag string) bool {
+	for _, v := range t {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Meta 实例元数据，实现Equal以便作为grpc的attribute值
+type Meta map[string]string
+
+func (m Meta) Equal(o interface{}) bool {
+	other, ok := o.(Meta)
+	if !ok || len(m) != len(other) {
+		return false
+	}
+	for k, v := range m {
+		if ov, ok := other[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Attributes 将实例信息转换为grpc的attribute
+func (s *ServiceInstance) Attributes() *attributes.Attributes {
+	return attributes.New(AttributeGroup, s.Group).
+		WithValue(AttributeWeight, s.Weight).
+		WithValue(AttributeVersion, s.Version).
+		WithValue(AttributeZone, s.Zone).
+		WithValue(AttributeTags, Tags(s.Tags)).
+		WithValue(AttributeMeta, Meta(s.Meta))
+}
+
+// WeightOf 从attribute中读取权重，未设置或为0时返回 DefaultWeight
+func WeightOf(attrs *attributes.Attributes) uint32 {
+	weight, ok := attrs.Value(AttributeWeight).(uint32)
+	if !ok || weight == 0 {
+		return DefaultWeight
+	}
+	return weight
+}
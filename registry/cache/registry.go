@@ -0,0 +1,348 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Registry 注册中心客户端缓存
+// 缓存每个服务最后一次已知的实例列表，后端不可用时在过期时间内
+// ListServices 返回缓存，Subscribe 返回的订阅在后台重试，恢复后通知订阅方全量刷新
+type Registry struct {
+	registry.Registry
+	services map[string]*entry
+	// staleness 后端失败时缓存的最长可用时间，从最后一次确认后端可用算起，<=0 表示不限制
+	staleness time.Duration
+	// snapshotStaleness 从快照恢复的缓存的最长可用时间，<=0 表示不限制
+	snapshotStaleness time.Duration
+	// snapshot 本地快照文件，为空表示不持久化
+	snapshot string
+	// timeout 事件触发重新拉取的超时时间
+	timeout time.Duration
+	mutex   sync.RWMutex
+	// saveMutex 保证快照按顺序写入
+	saveMutex sync.Mutex
+	close     chan struct{}
+	once      sync.Once
+}
+
+type RegistryOption func(r *Registry)
+
+// RegistryWithStaleness 后端失败时缓存的最长可用时间
+// 从最后一次确认后端可用算起：拉取成功、收到事件，订阅没有中断期间一直视为可用，
+// 实例长时间没有变化不会被当作过期；
+// 只限制本进程拉取到的数据；从快照恢复、启动后还没有刷新过的服务由 RegistryWithSnapshotStaleness 限制，
+// 否则注册中心不可用时，超过该时间的快照无法让客户端启动
+func RegistryWithStaleness(staleness time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.staleness = staleness
+	}
+}
+
+// RegistryWithSnapshotStaleness 从快照恢复的缓存的最长可用时间，从快照中的更新时间算起，默认24h
+// 注册中心长时间不可用时，避免一直使用早已下线的实例
+func RegistryWithSnapshotStaleness(staleness time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.snapshotStaleness = staleness
+	}
+}
+
+// RegistryWithTimeout 收到未知变更事件时重新拉取实例的超时时间，默认3s
+func RegistryWithTimeout(timeout time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.timeout = timeout
+	}
+}
+
+// RegistryWithSnapshot 将缓存持久化到本地文件，启动时先从文件加载
+// 这样注册中心不可用时客户端也能启动
+func RegistryWithSnapshot(path string) RegistryOption {
+	return func(r *Registry) {
+		r.snapshot = path
+	}
+}
+
+func NewRegistry(r registry.Registry, opts ...RegistryOption) (*Registry, error) {
+	res := &Registry{
+		Registry:          r,
+		services:          make(map[string]*entry, 8),
+		snapshotStaleness: 24 * time.Hour,
+		timeout:           3 * time.Second,
+		close:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	if res.snapshot != "" {
+		if err := res.load(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	instances, err := r.Registry.ListServices(ctx, serviceName)
+	if err == nil {
+		r.store(serviceName, instances)
+		r.watch(serviceName)
+		return instances, nil
+	}
+
+	// 后端失败，返回缓存
+	if instances, ok := r.cached(serviceName); ok {
+		return instances, nil
+	}
+	return nil, err
+}
+
+// Subscribe 后端订阅失败时，有可用的缓存就先返回订阅，在后台重试
+// 订阅成功后发送一个 EventTypeUnknown 事件，订阅方重新拉取全量实例
+func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	events, err := r.Registry.Subscribe(serviceName)
+	if err == nil {
+		return events, nil
+	}
+	if _, ok := r.cached(serviceName); !ok {
+		return nil, err
+	}
+
+	res := make(chan registry.Event)
+	go r.resubscribe(serviceName, res)
+	return res, nil
+}
+
+// resubscribeInterval 后端订阅失败后的重试间隔
+var resubscribeInterval = time.Second
+
+// resubscribe 直到后端订阅成功，之后转发后端的事件，后端订阅中断时关闭res，由订阅方重新订阅
+func (r *Registry) resubscribe(serviceName string, res chan<- registry.Event) {
+	defer close(res)
+	var events <-chan registry.Event
+	for events == nil {
+		select {
+		case <-time.After(resubscribeInterval):
+		case <-r.close:
+			return
+		}
+		events, _ = r.Registry.Subscribe(serviceName)
+	}
+
+	// 使用缓存期间的变更未知
+	event, ok := registry.Event{Type: registry.EventTypeUnknown}, true
+	for ok {
+		select {
+		case res <- event:
+		case <-r.close:
+			return
+		}
+		select {
+		case event, ok = <-events:
+		case <-r.close:
+			return
+		}
+	}
+}
+
+// cached 后端不可用时可以使用的缓存
+func (r *Registry) cached(serviceName string) ([]*registry.ServiceInstance, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	e, ok := r.services[serviceName]
+	if !ok {
+		return nil, false
+	}
+	if e.restored {
+		if r.snapshotStaleness > 0 && time.Since(e.UpdatedAt) > r.snapshotStaleness {
+			return nil, false
+		}
+		return e.list(), true
+	}
+	// 订阅还在，缓存和后端一致
+	if r.staleness > 0 && !e.watching && time.Since(e.confirmedAt) > r.staleness {
+		return nil, false
+	}
+	return e.list(), true
+}
+
+func (r *Registry) Close() error {
+	r.once.Do(func() {
+		close(r.close)
+	})
+	return r.Registry.Close()
+}
+
+// watch 每个服务只订阅一次，用变更事件刷新缓存
+func (r *Registry) watch(serviceName string) {
+	r.mutex.Lock()
+	e := r.services[serviceName]
+	if e.watching {
+		r.mutex.Unlock()
+		return
+	}
+	e.watching = true
+	r.mutex.Unlock()
+
+	events, err := r.Registry.Subscribe(serviceName)
+	if err != nil {
+		r.mutex.Lock()
+		e.watching = false
+		r.mutex.Unlock()
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					// 订阅中断，下次 ListServices 时重新订阅
+					r.mutex.Lock()
+					e.watching = false
+					e.confirmedAt = time.Now()
+					r.mutex.Unlock()
+					return
+				}
+				r.apply(serviceName, event)
+			case <-r.close:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Registry) apply(serviceName string, event registry.Event) {
+	// 不知道具体变更，重新拉取
+	if event.Instance == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		defer cancel()
+		if instances, err := r.Registry.ListServices(ctx, serviceName); err == nil {
+			r.store(serviceName, instances)
+		}
+		return
+	}
+
+	r.mutex.Lock()
+	e := r.services[serviceName]
+	prev, ok := e.Instances[event.Instance.Address]
+	changed := false
+	switch event.Type {
+	case registry.EventTypeAdd, registry.EventTypeUpdate:
+		changed = !ok || !reflect.DeepEqual(prev, event.Instance)
+		e.Instances[event.Instance.Address] = event.Instance
+	case registry.EventTypeDelete:
+		changed = ok
+		delete(e.Instances, event.Instance.Address)
+	}
+	e.UpdatedAt = time.Now()
+	e.confirmedAt = e.UpdatedAt
+	e.restored = false
+	r.mutex.Unlock()
+
+	if changed {
+		r.save()
+	}
+}
+
+func (r *Registry) store(serviceName string, instances []*registry.ServiceInstance) {
+	r.mutex.Lock()
+	e, ok := r.services[serviceName]
+	if !ok {
+		e = &entry{}
+		r.services[serviceName] = e
+	}
+	// cluster/* 每次调用都会 ListServices，实例没有变化时不写快照
+	changed := !ok || len(registry.Diff(e.list(), instances)) > 0
+	e.Instances = make(map[string]*registry.ServiceInstance, len(instances))
+	for _, si := range instances {
+		e.Instances[si.Address] = si
+	}
+	e.UpdatedAt = time.Now()
+	e.confirmedAt = e.UpdatedAt
+	e.restored = false
+	r.mutex.Unlock()
+
+	if changed {
+		r.save()
+	}
+}
+
+// load 从快照文件加载，文件不存在不算错误
+func (r *Registry) load() error {
+	data, err := os.ReadFile(r.snapshot)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	services := make(map[string]*entry, 8)
+	if err = json.Unmarshal(data, &services); err != nil {
+		return err
+	}
+	for _, e := range services {
+		if e.Instances == nil {
+			e.Instances = make(map[string]*registry.ServiceInstance)
+		}
+		e.restored = true
+	}
+	r.services = services
+	return nil
+}
+
+// save 写入快照文件，先写临时文件再重命名，避免写一半的文件
+func (r *Registry) save() {
+	if r.snapshot == "" {
+		return
+	}
+	r.saveMutex.Lock()
+	defer r.saveMutex.Unlock()
+
+	r.mutex.RLock()
+	data, err := json.Marshal(r.services)
+	r.mutex.RUnlock()
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.snapshot), filepath.Base(r.snapshot)+".tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if er := tmp.Close(); err == nil {
+		err = er
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	_ = os.Rename(tmp.Name(), r.snapshot)
+}
+
+type entry struct {
+	Instances map[string]*registry.ServiceInstance `json:"instances"`
+	UpdatedAt time.Time                            `json:"updated_at"`
+	// confirmedAt 最后一次确认后端可用的时间，不持久化
+	confirmedAt time.Time
+	watching    bool
+	// restored 从快照恢复，本进程还没有刷新过
+	restored bool
+}
+
+func (e *entry) list() []*registry.ServiceInstance {
+	res := make([]*registry.ServiceInstance, 0, len(e.Instances))
+	for _, si := range e.Instances {
+		res = append(res, si)
+	}
+	return res
+}
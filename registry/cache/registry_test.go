@@ -0,0 +1,251 @@
+package cache
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"micro/registry/memory"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ListServices(t *testing.T) {
+	backend := &unstableRegistry{Registry: memory.NewRegistry()}
+	r, err := NewRegistry(backend, RegistryWithStaleness(200*time.Millisecond))
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, got)
+
+	// 后端拉取失败，返回缓存
+	backend.fail.Store(true)
+	got, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, got)
+
+	// 没有缓存的服务直接返回错误
+	_, err = r.ListServices(ctx, "order-service")
+	assert.Equal(t, errUnavailable, err)
+
+	// 订阅没有中断，实例长时间没有变化也不算过期
+	time.Sleep(300 * time.Millisecond)
+	got, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, got)
+
+	// 订阅中断后从中断时开始计算
+	backend.down()
+	require.Eventually(t, func() bool {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+		return !r.services["user-service"].watching
+	}, time.Second, 10*time.Millisecond)
+	got, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, got)
+	time.Sleep(300 * time.Millisecond)
+	_, err = r.ListServices(ctx, "user-service")
+	assert.Equal(t, errUnavailable, err)
+}
+
+func TestRegistry_Subscribe(t *testing.T) {
+	backend := &unstableRegistry{Registry: memory.NewRegistry()}
+	r, err := NewRegistry(backend)
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	_, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+
+	// 变更事件刷新缓存
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+	backend.fail.Store(true)
+	require.Eventually(t, func() bool {
+		got, er := r.ListServices(ctx, "user-service")
+		return er == nil && len(got) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, backend.Registry.UnRegister(ctx, si))
+	require.Eventually(t, func() bool {
+		got, er := r.ListServices(ctx, "user-service")
+		return er == nil && len(got) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRegistry_Snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	ctx := context.Background()
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080", Group: "A"}
+
+	backend := &unstableRegistry{Registry: memory.NewRegistry()}
+	r, err := NewRegistry(backend, RegistryWithSnapshot(path))
+	require.NoError(t, err)
+	require.NoError(t, r.Register(ctx, si))
+	_, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	// 实例没有变化时不重写快照
+	require.NoError(t, os.Remove(path))
+	_, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// 变化后写入
+	other := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8081"}
+	require.NoError(t, r.Register(ctx, other))
+	_, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	require.NoError(t, r.UnRegister(ctx, other))
+	require.Eventually(t, func() bool {
+		got, err := r.ListServices(ctx, "user-service")
+		return err == nil && len(got) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, r.Close())
+
+	// 注册中心不可用时从快照启动，快照早于staleness也可以使用
+	time.Sleep(20 * time.Millisecond)
+	backend = &unstableRegistry{Registry: memory.NewRegistry()}
+	backend.fail.Store(true)
+	r, err = NewRegistry(backend, RegistryWithSnapshot(path), RegistryWithStaleness(10*time.Millisecond))
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, got)
+
+	// 快照超过 RegistryWithSnapshotStaleness 不再使用
+	stale, err := NewRegistry(backend, RegistryWithSnapshot(path), RegistryWithSnapshotStaleness(10*time.Millisecond))
+	require.NoError(t, err)
+	_, err = stale.ListServices(ctx, "user-service")
+	assert.Equal(t, errUnavailable, err)
+}
+
+func TestRegistry_SubscribeFallback(t *testing.T) {
+	interval := resubscribeInterval
+	resubscribeInterval = 10 * time.Millisecond
+	defer func() {
+		resubscribeInterval = interval
+	}()
+	backend := &unstableRegistry{Registry: memory.NewRegistry()}
+	r, err := NewRegistry(backend)
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+	_, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+
+	// 后端不可用，有缓存的服务仍然可以订阅
+	backend.fail.Store(true)
+	events, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+	_, err = r.Subscribe("order-service")
+	assert.Equal(t, errUnavailable, err)
+
+	// 后端恢复后先通知全量刷新，再转发后端的事件
+	backend.fail.Store(false)
+	select {
+	case event := <-events:
+		assert.Equal(t, registry.EventTypeUnknown, event.Type)
+	case <-time.After(time.Second):
+		t.Fatal("没有收到恢复事件")
+	}
+	other := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8081"}
+	require.NoError(t, backend.Registry.Register(ctx, other))
+	select {
+	case event := <-events:
+		assert.Equal(t, registry.EventTypeAdd, event.Type)
+		assert.Equal(t, other.Address, event.Instance.Address)
+	case <-time.After(time.Second):
+		t.Fatal("没有收到变更事件")
+	}
+}
+
+var errUnavailable = errors.New("mock: 注册中心不可用")
+
+type unstableRegistry struct {
+	registry.Registry
+	fail atomic.Bool
+
+	mutex sync.Mutex
+	stops []chan struct{}
+}
+
+// down 后端不可用，已有的订阅全部中断
+func (u *unstableRegistry) down() {
+	u.fail.Store(true)
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for _, stop := range u.stops {
+		close(stop)
+	}
+	u.stops = nil
+}
+
+func (u *unstableRegistry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	if u.fail.Load() {
+		return nil, errUnavailable
+	}
+	return u.Registry.ListServices(ctx, serviceName)
+}
+
+func (u *unstableRegistry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	if u.fail.Load() {
+		return nil, errUnavailable
+	}
+	events, err := u.Registry.Subscribe(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	stop := make(chan struct{})
+	u.mutex.Lock()
+	u.stops = append(u.stops, stop)
+	u.mutex.Unlock()
+
+	res := make(chan registry.Event)
+	go func() {
+		defer close(res)
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				select {
+				case res <- event:
+				case <-stop:
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return res, nil
+}
@@ -0,0 +1,44 @@
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+)
+
+// ErrReadOnly 只读注册中心（DNS、静态列表等）不支持注册
+var ErrReadOnly = errors.New("micro: 只读注册中心不支持注册")
+
+// Diff 比较同一个服务前后两次的全量实例，生成变更事件
+// 供只能轮询的注册中心使用，事件按地址排序，Revision由调用方设置
+func Diff(old, new []*ServiceInstance) []Event {
+	before := make(map[string]*ServiceInstance, len(old))
+	for _, si := range old {
+		before[si.Address] = si
+	}
+	after := make(map[string]*ServiceInstance, len(new))
+	for _, si := range new {
+		after[si.Address] = si
+	}
+
+	res := make([]Event, 0, len(new))
+	for addr, si := range after {
+		prev, ok := before[addr]
+		switch {
+		case !ok:
+			res = append(res, Event{Type: EventTypeAdd, Instance: si})
+		case !reflect.DeepEqual(prev, si):
+			res = append(res, Event{Type: EventTypeUpdate, Instance: si})
+		}
+	}
+	for addr, si := range before {
+		if _, ok := after[addr]; !ok {
+			res = append(res, Event{Type: EventTypeDelete, Instance: si})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Instance.Address < res[j].Instance.Address
+	})
+	return res
+}
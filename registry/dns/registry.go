@@ -0,0 +1,208 @@
+package dns
+
+import (
+	"golang.org/x/net/context"
+	"log/slog"
+	"micro/registry"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry 基于DNS的只读注册中心
+// 优先查询SRV记录，没有SRV记录且设置了端口时退化为A/AAAA记录
+// SRV记录按priority分组，只使用可用的priority最小的一组，weight作为实例权重
+type Registry struct {
+	resolver *net.Resolver
+	domain   string
+	port     int
+	interval time.Duration
+	timeout  time.Duration
+	close    chan struct{}
+	once     sync.Once
+}
+
+type RegistryOption func(r *Registry)
+
+// RegistryWithResolver 自定义DNS解析器，例如指定DNS服务器
+func RegistryWithResolver(resolver *net.Resolver) RegistryOption {
+	return func(r *Registry) {
+		r.resolver = resolver
+	}
+}
+
+// RegistryWithDomain 服务名追加的域名后缀，如 svc.cluster.local
+func RegistryWithDomain(domain string) RegistryOption {
+	return func(r *Registry) {
+		r.domain = strings.Trim(domain, ".")
+	}
+}
+
+// RegistryWithPort 使用A/AAAA记录时的端口
+func RegistryWithPort(port int) RegistryOption {
+	return func(r *Registry) {
+		r.port = port
+	}
+}
+
+// RegistryWithInterval 订阅时重新解析的间隔，默认30s
+func RegistryWithInterval(interval time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.interval = interval
+	}
+}
+
+func NewRegistry(opts ...RegistryOption) *Registry {
+	res := &Registry{
+		resolver: net.DefaultResolver,
+		interval: 30 * time.Second,
+		timeout:  5 * time.Second,
+		close:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	return registry.ErrReadOnly
+}
+
+func (r *Registry) UnRegister(ctx context.Context, service *registry.ServiceInstance) error {
+	return registry.ErrReadOnly
+}
+
+func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	name := r.name(serviceName)
+
+	_, srvs, err := r.resolver.LookupSRV(ctx, "", "", name)
+	if err == nil && len(srvs) > 0 {
+		return r.fromSRV(ctx, serviceName, srvs)
+	}
+	if r.port == 0 {
+		return nil, err
+	}
+
+	hosts, err := r.resolver.LookupHost(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*registry.ServiceInstance, 0, len(hosts))
+	for _, host := range hosts {
+		res = append(res, &registry.ServiceInstance{
+			Name:    serviceName,
+			Address: net.JoinHostPort(host, strconv.Itoa(r.port)),
+		})
+	}
+	sortInstances(res)
+	return res, nil
+}
+
+// fromSRV 将SRV的target解析成IP，grpc拨号时不再依赖系统DNS
+// 只使用priority最小的一组记录，这一组的target都无法解析时才使用下一组；
+// 单个target解析失败时跳过，不影响其他节点
+func (r *Registry) fromSRV(ctx context.Context, serviceName string, srvs []*net.SRV) ([]*registry.ServiceInstance, error) {
+	srvs = append([]*net.SRV(nil), srvs...)
+	sort.SliceStable(srvs, func(i, j int) bool {
+		return srvs[i].Priority < srvs[j].Priority
+	})
+
+	var lastErr error
+	for start := 0; start < len(srvs); {
+		end := start
+		for end < len(srvs) && srvs[end].Priority == srvs[start].Priority {
+			end++
+		}
+		res := make([]*registry.ServiceInstance, 0, end-start)
+		for _, srv := range srvs[start:end] {
+			target := strings.TrimSuffix(srv.Target, ".")
+			hosts, err := r.resolver.LookupHost(ctx, target)
+			if err != nil {
+				slog.Warn("micro: 解析SRV target失败", slog.String("service", serviceName),
+					slog.String("target", target), slog.String("error", err.Error()))
+				lastErr = err
+				continue
+			}
+			for _, host := range hosts {
+				res = append(res, &registry.ServiceInstance{
+					Name:    serviceName,
+					Address: net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+					Weight:  uint32(srv.Weight),
+				})
+			}
+		}
+		if len(res) > 0 {
+			sortInstances(res)
+			return res, nil
+		}
+		start = end
+	}
+	return nil, lastErr
+}
+
+// Subscribe 定时重新解析，有变化时产生事件，解析失败时保留上一次的结果
+func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	prev, _ := r.list(serviceName)
+
+	res := make(chan registry.Event)
+	go func() {
+		defer close(res)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		var revision int64
+		for {
+			select {
+			case <-ticker.C:
+			case <-r.close:
+				return
+			}
+
+			cur, err := r.list(serviceName)
+			if err != nil {
+				continue
+			}
+			for _, event := range registry.Diff(prev, cur) {
+				revision++
+				event.Revision = revision
+				select {
+				case res <- event:
+				case <-r.close:
+					return
+				}
+			}
+			prev = cur
+		}
+	}()
+	return res, nil
+}
+
+func (r *Registry) Close() error {
+	r.once.Do(func() {
+		close(r.close)
+	})
+	return nil
+}
+
+func (r *Registry) list(serviceName string) ([]*registry.ServiceInstance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return r.ListServices(ctx, serviceName)
+}
+
+func (r *Registry) name(serviceName string) string {
+	if r.domain == "" {
+		return serviceName
+	}
+	return serviceName + "." + r.domain
+}
+
+func sortInstances(instances []*registry.ServiceInstance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Address < instances[j].Address
+	})
+}
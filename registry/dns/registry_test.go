@@ -0,0 +1,298 @@
+package dns
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"golang.org/x/net/dns/dnsmessage"
+	"micro"
+	"micro/demo/grpc/proto"
+	"micro/registry"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ListServices(t *testing.T) {
+	stub := newDNSServer(t)
+	stub.setSRV("user-service.svc.local.", "node1.svc.local.", 8080, 20)
+	stub.setA("node1.svc.local.", "10.0.0.1", "10.0.0.2")
+	stub.setA("order-service.svc.local.", "10.0.0.3")
+
+	r := NewRegistry(RegistryWithResolver(stub.resolver()), RegistryWithDomain("svc.local"))
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	// SRV记录
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{
+		{Name: "user-service", Address: "10.0.0.1:8080", Weight: 20},
+		{Name: "user-service", Address: "10.0.0.2:8080", Weight: 20},
+	}, got)
+
+	// 没有SRV记录也没有端口
+	_, err = r.ListServices(ctx, "order-service")
+	assert.Error(t, err)
+
+	// A记录
+	r = NewRegistry(RegistryWithResolver(stub.resolver()), RegistryWithDomain("svc.local"), RegistryWithPort(9090))
+	got, err = r.ListServices(ctx, "order-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{
+		{Name: "order-service", Address: "10.0.0.3:9090"},
+	}, got)
+
+	assert.Equal(t, registry.ErrReadOnly, r.Register(ctx, got[0]))
+	assert.Equal(t, registry.ErrReadOnly, r.UnRegister(ctx, got[0]))
+}
+
+func TestRegistry_SRVPriority(t *testing.T) {
+	stub := newDNSServer(t)
+	stub.addSRV("user-service.svc.local.", "node1.svc.local.", 8080, 10, 1)
+	stub.addSRV("user-service.svc.local.", "missing.svc.local.", 8080, 10, 1)
+	stub.addSRV("user-service.svc.local.", "backup.svc.local.", 8080, 10, 2)
+	stub.setA("node1.svc.local.", "10.0.0.1")
+	stub.setA("backup.svc.local.", "10.0.0.9")
+
+	r := NewRegistry(RegistryWithResolver(stub.resolver()), RegistryWithDomain("svc.local"))
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	// 无法解析的target跳过，备用的priority不使用
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{
+		{Name: "user-service", Address: "10.0.0.1:8080", Weight: 10},
+	}, got)
+
+	// 最小priority的target都无法解析时使用下一组
+	stub.mutex.Lock()
+	delete(stub.a, "node1.svc.local.")
+	stub.mutex.Unlock()
+	got, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{
+		{Name: "user-service", Address: "10.0.0.9:8080", Weight: 10},
+	}, got)
+}
+
+func TestRegistry_Subscribe(t *testing.T) {
+	stub := newDNSServer(t)
+	stub.setSRV("user-service.svc.local.", "node1.svc.local.", 8080, 10)
+	stub.setA("node1.svc.local.", "10.0.0.1")
+
+	r := NewRegistry(RegistryWithResolver(stub.resolver()), RegistryWithDomain("svc.local"),
+		RegistryWithInterval(20*time.Millisecond))
+	events, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+
+	stub.setA("node1.svc.local.", "10.0.0.1", "10.0.0.2")
+	select {
+	case event := <-events:
+		assert.Equal(t, registry.EventTypeAdd, event.Type)
+		assert.Equal(t, "10.0.0.2:8080", event.Instance.Address)
+	case <-time.After(time.Second):
+		t.Fatal("未收到变更事件")
+	}
+
+	stub.setA("node1.svc.local.", "10.0.0.2")
+	select {
+	case event := <-events:
+		assert.Equal(t, registry.EventTypeDelete, event.Type)
+		assert.Equal(t, "10.0.0.1:8080", event.Instance.Address)
+	case <-time.After(time.Second):
+		t.Fatal("未收到变更事件")
+	}
+
+	require.NoError(t, r.Close())
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel未关闭")
+	}
+}
+
+func TestRegistry_Dial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server, err := micro.NewServer("user-service")
+	require.NoError(t, err)
+	proto.RegisterUserServiceServer(server, &UserServer{})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.GracefulStop()
+
+	stub := newDNSServer(t)
+	stub.setSRV("user-service.svc.local.", "node1.svc.local.", uint16(listener.Addr().(*net.TCPAddr).Port), 10)
+	stub.setA("node1.svc.local.", "127.0.0.1")
+	r := NewRegistry(RegistryWithResolver(stub.resolver()), RegistryWithDomain("svc.local"))
+	defer func() {
+		_ = r.Close()
+	}()
+
+	client, err := micro.NewClient(micro.ClientInsecure(), micro.ClientWithRegistry(r, time.Second))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cc, err := client.Dial(ctx, "user-service")
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	resp, err := proto.NewUserServiceClient(cc).GetByID(ctx, &proto.Request{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), resp.User.Id)
+}
+
+type UserServer struct {
+	proto.UnimplementedUserServiceServer
+}
+
+func (s *UserServer) GetByID(ctx context.Context, request *proto.Request) (*proto.Response, error) {
+	return &proto.Response{
+		User: &proto.User{
+			Id:   request.Id,
+			Name: "hello,world",
+		},
+	}, nil
+}
+
+// dnsServer 本地DNS桩服务，只支持SRV和A记录
+type dnsServer struct {
+	conn  net.PacketConn
+	srv   map[string][]dnsmessage.SRVResource
+	a     map[string][][4]byte
+	mutex sync.Mutex
+}
+
+func newDNSServer(t *testing.T) *dnsServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	res := &dnsServer{
+		conn: conn,
+		srv:  make(map[string][]dnsmessage.SRVResource),
+		a:    make(map[string][][4]byte),
+	}
+	go res.serve()
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return res
+}
+
+func (s *dnsServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *dnsServer) setSRV(name, target string, port, weight uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.srv[name] = []dnsmessage.SRVResource{{
+		Target: dnsmessage.MustNewName(target),
+		Port:   port,
+		Weight: weight,
+	}}
+}
+
+func (s *dnsServer) addSRV(name, target string, port, weight, priority uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.srv[name] = append(s.srv[name], dnsmessage.SRVResource{
+		Target:   dnsmessage.MustNewName(target),
+		Port:     port,
+		Weight:   weight,
+		Priority: priority,
+	})
+}
+
+func (s *dnsServer) setA(name string, ips ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	records := make([][4]byte, 0, len(ips))
+	for _, ip := range ips {
+		var a [4]byte
+		copy(a[:], net.ParseIP(ip).To4())
+		records = append(records, a)
+	}
+	s.a[name] = records
+}
+
+func (s *dnsServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg, err := s.answer(buf[:n])
+		if err != nil {
+			continue
+		}
+		_, _ = s.conn.WriteTo(msg, addr)
+	}
+}
+
+func (s *dnsServer) answer(req []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(req)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	name := q.Name.String()
+	_, hasSRV := s.srv[name]
+	_, hasA := s.a[name]
+
+	header := dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true}
+	if !hasSRV && !hasA {
+		header.RCode = dnsmessage.RCodeNameError
+	}
+	b := dnsmessage.NewBuilder(nil, header)
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = b.Question(q); err != nil {
+		return nil, err
+	}
+	if err = b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET}
+	switch q.Type {
+	case dnsmessage.TypeSRV:
+		for _, srv := range s.srv[name] {
+			if err = b.SRVResource(rh, srv); err != nil {
+				return nil, err
+			}
+		}
+	case dnsmessage.TypeA:
+		for _, a := range s.a[name] {
+			if err = b.AResource(rh, dnsmessage.AResource{A: a}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.Finish()
+}
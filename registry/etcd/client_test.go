@@ -23,7 +23,7 @@ func TestClient(t *testing.T) {
 		micro.ClientInsecure(),
 		micro.ClientWithRegistry(registry, 3*time.Second),
 		//micro.ClientWithPickBuilder("DOME_ROUND_ROBIN", &round_robin.Builder{
-		//	Filter: (route.GroupFilter{Croup: "B"}).Build(),
+		//	Filter: (route.GroupFilter{Group: "B"}).Build(),
 		//}),
 	)
 	require.NoError(t, err)
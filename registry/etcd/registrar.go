@@ -1,46 +1,149 @@
 package etcd
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
 	"golang.org/x/net/context"
 	"micro/registry"
+	"micro/rpc/serialize"
+	"micro/rpc/serialize/json"
+	"strings"
 	"sync"
+	"time"
 )
 
+var errRegistryClosed = errors.New("micro: 注册中心已关闭")
+
 type Registry struct {
 	client  *clientv3.Client
 	session *concurrency.Session
 	cancels []func()
 	mutex   sync.Mutex
+
+	ttl           int
+	retryInterval time.Duration
+	// services 本实例注册过的服务，session重建后需要重新写入
+	services     map[string]*registry.ServiceInstance
+	onReRegister ReRegisterHook
+
+	// key格式: <prefix>/<namespace>/<service>/<address>
+	prefix     string
+	namespace  string
+	serializer serialize.Serializer
+
+	close chan struct{}
+	once  sync.Once
+}
+
+// ReRegisterHook session丢失后重新注册的回调
+// err不为nil表示重新注册失败，会在retryInterval后重试
+type ReRegisterHook func(instances []*registry.ServiceInstance, err error)
+
+type RegistryOption func(r *Registry)
+
+// RegistryWithTTL 租约过期时间，默认60s，etcd租约以秒为单位，不足1s的部分向上取整
+func RegistryWithTTL(ttl time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.ttl = int((ttl + time.Second - 1) / time.Second)
+	}
+}
+
+// RegistryWithRetryInterval session重建失败后的重试间隔，默认1s
+func RegistryWithRetryInterval(interval time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.retryInterval = interval
+	}
+}
+
+// RegistryWithReRegisterHook 重新注册时回调，可用于告警和打点
+func RegistryWithReRegisterHook(hook ReRegisterHook) RegistryOption {
+	return func(r *Registry) {
+		r.onReRegister = hook
+	}
+}
+
+// RegistryWithPrefix key的根路径，默认 /micro
+func RegistryWithPrefix(prefix string) RegistryOption {
+	return func(r *Registry) {
+		r.prefix = prefix
+	}
+}
+
+// RegistryWithNamespace 命名空间（环境、租户等），共用etcd集群时互相隔离
+func RegistryWithNamespace(namespace string) RegistryOption {
+	return func(r *Registry) {
+		r.namespace = namespace
+	}
 }
 
-func NewRegistry(client *clientv3.Client) (*Registry, error) {
+// RegistryWithSerializer 实例信息的序列化协议，默认json
+func RegistryWithSerializer(serializer serialize.Serializer) RegistryOption {
+	return func(r *Registry) {
+		r.serializer = serializer
+	}
+}
+
+func NewRegistry(client *clientv3.Client, opts ...RegistryOption) (*Registry, error) {
+	res := &Registry{
+		client:        client,
+		ttl:           60,
+		retryInterval: time.Second,
+		services:      make(map[string]*registry.ServiceInstance, 4),
+		prefix:        "/micro",
+		serializer:    &json.Serializer{},
+		close:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	// concurrency.WithTTL 会忽略<=0的值，保持和session实际使用的TTL一致
+	if res.ttl <= 0 {
+		res.ttl = 60
+	}
+
 	// session内部已经实现心跳
-	session, err := concurrency.NewSession(client, concurrency.WithTTL(60))
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(res.ttl))
 	if err != nil {
 		return nil, err
 	}
-	return &Registry{
-		client:  client,
-		session: session,
-	}, nil
+	res.session = session
+
+	go res.keepalive(session)
+	return res, nil
 }
 
 func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
-	val, err := json.Marshal(service)
+	val, err := r.serializer.Encode(service)
 	if err != nil {
 		return err
 	}
 
+	// 先记录，保证写入期间session重建也能被重新注册
+	key := r.instanceKey(service)
+	r.mutex.Lock()
+	r.services[key] = service
+	lease := r.session.Lease()
+	r.mutex.Unlock()
+
 	// 将服务实例和租约信息写入etcd
-	_, err = r.client.Put(ctx, r.instanceKey(service), string(val), clientv3.WithLease(r.session.Lease()))
+	_, err = r.client.Put(ctx, key, string(val), clientv3.WithLease(lease))
+	if err != nil {
+		// session已经重建时，实例已经或即将由 reRegister 写入新租约，需要保留
+		r.mutex.Lock()
+		if r.session.Lease() == lease && r.services[key] == service {
+			delete(r.services, key)
+		}
+		r.mutex.Unlock()
+	}
 	return err
 }
 
 func (r *Registry) UnRegister(ctx context.Context, service *registry.ServiceInstance) error {
+	r.mutex.Lock()
+	delete(r.services, r.instanceKey(service))
+	r.mutex.Unlock()
+
 	_, err := r.client.Delete(ctx, r.instanceKey(service))
 	return err
 }
@@ -55,7 +158,7 @@ func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*reg
 	for _, kv := range response.Kvs {
 		si := &registry.ServiceInstance{}
 
-		err = json.Unmarshal(kv.Value, si)
+		err = r.serializer.Decode(kv.Value, si)
 		if err != nil {
 			return nil, err
 		}
@@ -66,27 +169,40 @@ func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*reg
 	return res, nil
 }
 
+// Subscribe watch失败（如etcd切主、重启）或注册中心关闭时，返回的channel会被关闭，订阅方需要重新订阅
 func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	select {
+	case <-r.close:
+		return nil, errRegistryClosed
+	default:
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	r.mutex.Lock()
 	r.cancels = append(r.cancels, cancel)
 	r.mutex.Unlock()
 
 	ctx = clientv3.WithRequireLeader(ctx)
-	watchResp := r.client.Watch(ctx, r.serviceKey(serviceName), clientv3.WithPrefix())
+	watchResp := r.client.Watch(ctx, r.serviceKey(serviceName), clientv3.WithPrefix(), clientv3.WithPrevKV())
 
 	res := make(chan registry.Event)
 	go func() {
+		defer close(res)
+		defer cancel()
 		for {
 			select {
-			case resp := <-watchResp:
+			case resp, ok := <-watchResp:
 				// 监听到事件变更
-				if resp.Err() != nil || resp.Canceled {
+				if !ok || resp.Err() != nil || resp.Canceled {
 					return
 				}
 
-				for range resp.Events {
-					res <- registry.Event{}
+				for _, ev := range resp.Events {
+					select {
+					case res <- r.convertEvent(ev):
+					case <-ctx.Done():
+						return
+					}
 				}
 			case <-ctx.Done():
 				// 退出信号
@@ -99,9 +215,14 @@ func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error)
 }
 
 func (r *Registry) Close() error {
+	r.once.Do(func() {
+		close(r.close)
+	})
+
 	r.mutex.Lock()
 	cancels := r.cancels
 	r.cancels = nil
+	session := r.session
 	r.mutex.Unlock()
 
 	// 逐个关闭监听事件
@@ -109,13 +230,136 @@ func (r *Registry) Close() error {
 		cancel()
 	}
 
-	return r.session.Close()
+	return session.Close()
+}
+
+// keepalive 监听session，租约丢失（网络分区、etcd重启）后重建session并重新注册
+// etcd客户端被外部关闭后无法再重建，直接退出
+func (r *Registry) keepalive(session *concurrency.Session) {
+	for {
+		select {
+		case <-session.Done():
+		case <-r.close:
+			return
+		case <-r.client.Ctx().Done():
+			return
+		}
+
+		// 主动关闭
+		select {
+		case <-r.close:
+			return
+		case <-r.client.Ctx().Done():
+			return
+		default:
+		}
+
+		session = r.renew()
+		if session == nil {
+			return
+		}
+	}
+}
+
+// renew 重建session并重新写入所有实例，直到成功、注册中心关闭或etcd客户端关闭
+func (r *Registry) renew() *concurrency.Session {
+	for {
+		session, instances, err := r.reRegister()
+		if r.onReRegister != nil {
+			r.onReRegister(instances, err)
+		}
+		if err == nil {
+			return session
+		}
+
+		select {
+		case <-time.After(r.retryInterval):
+		case <-r.close:
+			return nil
+		case <-r.client.Ctx().Done():
+			return nil
+		}
+	}
+}
+
+func (r *Registry) reRegister() (*concurrency.Session, []*registry.ServiceInstance, error) {
+	session, err := concurrency.NewSession(r.client, concurrency.WithTTL(r.ttl))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.mutex.Lock()
+	r.session = session
+	instances := make([]*registry.ServiceInstance, 0, len(r.services))
+	for _, si := range r.services {
+		instances = append(instances, si)
+	}
+	r.mutex.Unlock()
+
+	// Close与重建并发时，保证新的session也被关闭
+	select {
+	case <-r.close:
+		_ = session.Close()
+		return nil, instances, nil
+	default:
+	}
+
+	// 需要在新租约过期前写完，r.ttl 和session实际使用的TTL一致，至少1s
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.ttl)*time.Second)
+	defer cancel()
+	for _, si := range instances {
+		val, _ := r.serializer.Encode(si)
+		_, err = r.client.Put(ctx, r.instanceKey(si), string(val), clientv3.WithLease(session.Lease()))
+		if err != nil {
+			// 撤销新租约，已写入的部分随之删除，下一轮重试
+			_ = session.Close()
+			return nil, instances, err
+		}
+	}
+	return session, instances, nil
+}
+
+// convertEvent 将etcd的watch事件转换为注册中心事件
+func (r *Registry) convertEvent(ev *clientv3.Event) registry.Event {
+	res := registry.Event{
+		Revision: ev.Kv.ModRevision,
+	}
+
+	kv := ev.Kv
+	switch {
+	case ev.Type == clientv3.EventTypeDelete:
+		res.Type = registry.EventTypeDelete
+		// 删除事件的value为空，从上一个版本中取实例信息
+		kv = ev.PrevKv
+	case ev.IsCreate():
+		res.Type = registry.EventTypeAdd
+	default:
+		res.Type = registry.EventTypeUpdate
+	}
+
+	if kv == nil || len(kv.Value) == 0 {
+		return res
+	}
+	si := &registry.ServiceInstance{}
+	if err := r.serializer.Decode(kv.Value, si); err == nil {
+		res.Instance = si
+	}
+	return res
 }
 
 func (r *Registry) instanceKey(service *registry.ServiceInstance) string {
-	return fmt.Sprintf("/micro/%s/%s", service.Name, service.Address)
+	return r.serviceKey(service.Name) + service.Address
 }
 
+// serviceKey 以分隔符结尾，前缀匹配时 user-service 不会匹配到 user-service-v2
 func (r *Registry) serviceKey(service string) string {
-	return fmt.Sprintf("/micro/%s", service)
+	return r.root() + "/" + service + "/"
+}
+
+func (r *Registry) root() string {
+	root := strings.TrimSuffix(r.prefix, "/")
+	if r.namespace != "" {
+		root = root + "/" + strings.Trim(r.namespace, "/")
+	}
+	return root
 }
@@ -0,0 +1,163 @@
+package etcd
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ReRegister(t *testing.T) {
+	etcdClient := newEtcdClient(t)
+
+	hooked := make(chan []*registry.ServiceInstance, 1)
+	r, err := NewRegistry(etcdClient,
+		RegistryWithTTL(5*time.Second),
+		RegistryWithRetryInterval(100*time.Millisecond),
+		RegistryWithReRegisterHook(func(instances []*registry.ServiceInstance, err error) {
+			if err == nil {
+				hooked <- instances
+			}
+		}),
+	)
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	si := &registry.ServiceInstance{Name: "re-register-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+
+	// 模拟租约丢失
+	r.mutex.Lock()
+	lease := r.session.Lease()
+	r.mutex.Unlock()
+	_, err = etcdClient.Revoke(ctx, lease)
+	require.NoError(t, err)
+
+	select {
+	case instances := <-hooked:
+		assert.Equal(t, []*registry.ServiceInstance{si}, instances)
+	case <-time.After(5 * time.Second):
+		t.Fatal("未重新注册")
+	}
+
+	instances, err := r.ListServices(ctx, si.Name)
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, instances)
+}
+
+func TestRegistry_ClientClosed(t *testing.T) {
+	etcdClient := newEtcdClient(t)
+
+	var mutex sync.Mutex
+	var hooks int
+	r, err := NewRegistry(etcdClient,
+		RegistryWithTTL(5*time.Second),
+		RegistryWithRetryInterval(10*time.Millisecond),
+		RegistryWithReRegisterHook(func(instances []*registry.ServiceInstance, err error) {
+			mutex.Lock()
+			hooks++
+			mutex.Unlock()
+		}),
+	)
+	require.NoError(t, err)
+
+	// 外部关闭etcd客户端后不再重试
+	require.NoError(t, etcdClient.Close())
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	before := hooks
+	mutex.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	assert.Equal(t, before, hooks)
+	mutex.Unlock()
+	_ = r.Close()
+}
+
+func TestRegistryWithTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want int
+	}{
+		{ttl: 10 * time.Second, want: 10},
+		// 不足1s的部分向上取整，不会变成0
+		{ttl: 500 * time.Millisecond, want: 1},
+		{ttl: 1500 * time.Millisecond, want: 2},
+		{ttl: 0, want: 0},
+	}
+	for _, tt := range tests {
+		r := &Registry{}
+		RegistryWithTTL(tt.ttl)(r)
+		assert.Equal(t, tt.want, r.ttl, tt.ttl.String())
+	}
+}
+
+func TestRegistry_Key(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []RegistryOption
+		wantService string
+		wantKey     string
+	}{
+		{
+			name:        "default",
+			wantService: "/micro/user-service/",
+			wantKey:     "/micro/user-service/127.0.0.1:8080",
+		},
+		{
+			name:        "namespace",
+			opts:        []RegistryOption{RegistryWithNamespace("test")},
+			wantService: "/micro/test/user-service/",
+			wantKey:     "/micro/test/user-service/127.0.0.1:8080",
+		},
+		{
+			name:        "prefix with slash",
+			opts:        []RegistryOption{RegistryWithPrefix("/services/"), RegistryWithNamespace("/tenant-a/")},
+			wantService: "/services/tenant-a/user-service/",
+			wantKey:     "/services/tenant-a/user-service/127.0.0.1:8080",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Registry{prefix: "/micro"}
+			for _, opt := range tt.opts {
+				opt(r)
+			}
+			assert.Equal(t, tt.wantService, r.serviceKey("user-service"))
+			assert.Equal(t, tt.wantKey, r.instanceKey(&registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}))
+			// 前缀不会匹配到同名前缀的其他服务
+			assert.False(t, strings.HasPrefix(r.instanceKey(&registry.ServiceInstance{Name: "user-service-v2", Address: "127.0.0.1:8080"}), tt.wantService))
+		})
+	}
+}
+
+// newEtcdClient 本地没有etcd时跳过
+func newEtcdClient(t *testing.T) *clientv3.Client {
+	etcdClient, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{"127.0.0.1:2379"},
+		DialTimeout: time.Second,
+	})
+	if err != nil {
+		t.Skip("etcd不可用", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err = etcdClient.Status(ctx, "127.0.0.1:2379"); err != nil {
+		_ = etcdClient.Close()
+		t.Skip("etcd不可用", err)
+	}
+	t.Cleanup(func() {
+		_ = etcdClient.Close()
+	})
+	return etcdClient
+}
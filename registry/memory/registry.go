@@ -0,0 +1,304 @@
+package memory
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"sync"
+	"time"
+)
+
+var errRegistryClosed = errors.New("micro: 注册中心已关闭")
+
+// Registry 基于内存的注册中心，适用于测试和单进程部署
+type Registry struct {
+	services    map[string]map[string]*instance
+	subscribers map[string][]*subscriber
+	ttl         time.Duration
+	revision    int64
+	close       chan struct{}
+	closed      bool
+	once        sync.Once
+	mutex       sync.RWMutex
+}
+
+type RegistryOption func(r *Registry)
+
+// RegistryWithTTL 实例过期时间，重复调用Register会刷新过期时间
+// ttl <= 0 表示实例永不过期
+func RegistryWithTTL(ttl time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.ttl = ttl
+	}
+}
+
+func NewRegistry(opts ...RegistryOption) *Registry {
+	res := &Registry{
+		services:    make(map[string]map[string]*instance, 16),
+		subscribers: make(map[string][]*subscriber, 16),
+		close:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	// 定时清理过期实例
+	if res.ttl > 0 {
+		go res.sweep()
+	}
+	return res
+}
+
+func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return errRegistryClosed
+	}
+
+	instances, ok := r.services[service.Name]
+	if !ok {
+		instances = make(map[string]*instance, 4)
+		r.services[service.Name] = instances
+	}
+
+	typ := registry.EventTypeAdd
+	if _, ok = instances[service.Address]; ok {
+		typ = registry.EventTypeUpdate
+	}
+	ins := &instance{
+		service: copyInstance(service),
+	}
+	if r.ttl > 0 {
+		ins.expireAt = time.Now().Add(r.ttl)
+	}
+	instances[service.Address] = ins
+
+	r.notify(typ, ins.service)
+	return nil
+}
+
+func (r *Registry) UnRegister(ctx context.Context, service *registry.ServiceInstance) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return errRegistryClosed
+	}
+
+	instances, ok := r.services[service.Name]
+	if !ok {
+		return nil
+	}
+	ins, ok := instances[service.Address]
+	if !ok {
+		return nil
+	}
+
+	delete(instances, service.Address)
+	if len(instances) == 0 {
+		delete(r.services, service.Name)
+	}
+
+	r.notify(registry.EventTypeDelete, ins.service)
+	return nil
+}
+
+func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.closed {
+		return nil, errRegistryClosed
+	}
+
+	now := time.Now()
+	instances := r.services[serviceName]
+	res := make([]*registry.ServiceInstance, 0, len(instances))
+	for _, ins := range instances {
+		// 已过期但还未被清理
+		if ins.expired(now) {
+			continue
+		}
+		res = append(res, copyInstance(ins.service))
+	}
+	return res, nil
+}
+
+func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return nil, errRegistryClosed
+	}
+
+	sub := newSubscriber()
+	r.subscribers[serviceName] = append(r.subscribers[serviceName], sub)
+	go sub.loop(r.close)
+
+	return sub.ch, nil
+}
+
+// Close 关闭注册中心，所有订阅的channel都会被关闭
+func (r *Registry) Close() error {
+	r.once.Do(func() {
+		r.mutex.Lock()
+		r.closed = true
+		r.services = nil
+		r.subscribers = nil
+		r.mutex.Unlock()
+
+		close(r.close)
+	})
+	return nil
+}
+
+// notify 通知订阅者，调用方需持有锁
+func (r *Registry) notify(typ registry.EventType, service *registry.ServiceInstance) {
+	r.revision++
+	for _, sub := range r.subscribers[service.Name] {
+		sub.push(registry.Event{
+			Type:     typ,
+			Instance: copyInstance(service),
+			Revision: r.revision,
+		})
+	}
+}
+
+func (r *Registry) sweep() {
+	interval := r.ttl / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.removeExpired()
+		case <-r.close:
+			return
+		}
+	}
+}
+
+func (r *Registry) removeExpired() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return
+	}
+
+	now := time.Now()
+	for name, instances := range r.services {
+		for addr, ins := range instances {
+			if ins.expired(now) {
+				delete(instances, addr)
+				r.notify(registry.EventTypeDelete, ins.service)
+			}
+		}
+		if len(instances) == 0 {
+			delete(r.services, name)
+		}
+	}
+}
+
+type instance struct {
+	service  *registry.ServiceInstance
+	expireAt time.Time
+}
+
+func (i *instance) expired(now time.Time) bool {
+	return !i.expireAt.IsZero() && now.After(i.expireAt)
+}
+
+func copyInstance(service *registry.ServiceInstance) *registry.ServiceInstance {
+	res := *service
+	if service.Tags != nil {
+		res.Tags = append([]string(nil), service.Tags...)
+	}
+	if service.Meta != nil {
+		res.Meta = make(map[string]string, len(service.Meta))
+		for k, v := range service.Meta {
+			res.Meta[k] = v
+		}
+	}
+	return &res
+}
+
+// maxQueue 每个订阅者最多缓存的事件数
+var maxQueue = 1024
+
+// subscriber 每个订阅者一个有界队列，慢消费者不会阻塞注册和其他订阅者
+// 队列满时合并为一个 EventTypeUnknown 事件，订阅方收到后重新拉取全量实例；
+// 订阅方不再消费时（如resolver关闭后）占用的内存也不会无限增长
+type subscriber struct {
+	ch     chan registry.Event
+	queue  []registry.Event
+	signal chan struct{}
+	mutex  sync.Mutex
+	// overflowed 队列中只有合并后的事件，之后的事件都会被重新拉取覆盖
+	overflowed bool
+}
+
+func newSubscriber() *subscriber {
+	return &subscriber{
+		ch:     make(chan registry.Event),
+		signal: make(chan struct{}, 1),
+	}
+}
+
+func (s *subscriber) push(event registry.Event) {
+	s.mutex.Lock()
+	switch {
+	case s.overflowed:
+	case len(s.queue) >= maxQueue:
+		s.queue = []registry.Event{{Type: registry.EventTypeUnknown, Revision: event.Revision}}
+		s.overflowed = true
+	default:
+		s.queue = append(s.queue, event)
+	}
+	s.mutex.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) loop(done <-chan struct{}) {
+	defer close(s.ch)
+	for {
+		s.mutex.Lock()
+		events := s.queue
+		s.queue = nil
+		s.overflowed = false
+		s.mutex.Unlock()
+
+		for _, event := range events {
+			select {
+			case s.ch <- event:
+			case <-done:
+				return
+			}
+		}
+
+		select {
+		case <-s.signal:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"micro"
+	"micro/demo/grpc/proto"
+	"micro/registry"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		action  func() error
+		service string
+		want    []*registry.ServiceInstance
+	}{
+		{
+			name: "register",
+			action: func() error {
+				return r.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080", Group: "A"})
+			},
+			service: "user-service",
+			want: []*registry.ServiceInstance{
+				{Name: "user-service", Address: "127.0.0.1:8080", Group: "A"},
+			},
+		},
+		{
+			name: "register again update",
+			action: func() error {
+				return r.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080", Group: "B"})
+			},
+			service: "user-service",
+			want: []*registry.ServiceInstance{
+				{Name: "user-service", Address: "127.0.0.1:8080", Group: "B"},
+			},
+		},
+		{
+			name: "other service",
+			action: func() error {
+				return r.Register(ctx, &registry.ServiceInstance{Name: "order-service", Address: "127.0.0.1:8081"})
+			},
+			service: "order-service",
+			want: []*registry.ServiceInstance{
+				{Name: "order-service", Address: "127.0.0.1:8081"},
+			},
+		},
+		{
+			name: "unregister",
+			action: func() error {
+				return r.UnRegister(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"})
+			},
+			service: "user-service",
+			want:    []*registry.ServiceInstance{},
+		},
+		{
+			name: "unregister not exist",
+			action: func() error {
+				return r.UnRegister(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:9090"})
+			},
+			service: "user-service",
+			want:    []*registry.ServiceInstance{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.action())
+			got, err := r.ListServices(ctx, tt.service)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRegistry_Subscribe(t *testing.T) {
+	r := NewRegistry()
+	ctx := context.Background()
+
+	// 多个订阅者都能收到变更
+	var subs []<-chan registry.Event
+	for i := 0; i < 3; i++ {
+		ch, err := r.Subscribe("user-service")
+		require.NoError(t, err)
+		subs = append(subs, ch)
+	}
+	other, err := r.Subscribe("order-service")
+	require.NoError(t, err)
+
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+	require.NoError(t, r.UnRegister(ctx, si))
+
+	wantTypes := []registry.EventType{registry.EventTypeAdd, registry.EventTypeDelete}
+	for _, ch := range subs {
+		var revision int64
+		for _, typ := range wantTypes {
+			select {
+			case event := <-ch:
+				assert.Equal(t, typ, event.Type)
+				assert.Equal(t, si, event.Instance)
+				assert.Greater(t, event.Revision, revision)
+				revision = event.Revision
+			case <-time.After(time.Second):
+				t.Fatal("未收到变更事件")
+			}
+		}
+	}
+
+	select {
+	case <-other:
+		t.Fatal("不应收到其他服务的事件")
+	default:
+	}
+
+	// 关闭后channel被关闭
+	require.NoError(t, r.Close())
+	for _, ch := range append(subs, other) {
+		select {
+		case _, ok := <-ch:
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			t.Fatal("channel未关闭")
+		}
+	}
+
+	_, err = r.Subscribe("user-service")
+	assert.Equal(t, errRegistryClosed, err)
+	assert.Equal(t, errRegistryClosed, r.Register(ctx, si))
+}
+
+func TestRegistry_SlowSubscriber(t *testing.T) {
+	r := NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	_, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+
+	// 没有人消费也不会阻塞注册
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = r.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"})
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("注册被订阅者阻塞")
+	}
+}
+
+func TestRegistry_SubscriberOverflow(t *testing.T) {
+	size := maxQueue
+	maxQueue = 4
+	defer func() {
+		maxQueue = size
+	}()
+	r := NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	events, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+	r.mutex.RLock()
+	sub := r.subscribers["user-service"][0]
+	r.mutex.RUnlock()
+
+	// 没有人消费，队列不会超过上限
+	for i := 0; i < 100; i++ {
+		require.NoError(t, r.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: fmt.Sprintf("127.0.0.1:%d", 8080+i)}))
+	}
+	sub.mutex.Lock()
+	assert.LessOrEqual(t, len(sub.queue), maxQueue)
+	sub.mutex.Unlock()
+
+	// 溢出的事件合并为一个未知变更，订阅方重新拉取
+	var last registry.Event
+	for {
+		select {
+		case last = <-events:
+			continue
+		case <-time.After(50 * time.Millisecond):
+		}
+		break
+	}
+	assert.Equal(t, registry.EventTypeUnknown, last.Type)
+	assert.Nil(t, last.Instance)
+}
+
+func TestRegistry_TTL(t *testing.T) {
+	r := NewRegistry(RegistryWithTTL(100 * time.Millisecond))
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	events, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+	assert.Equal(t, registry.EventTypeAdd, (<-events).Type)
+
+	// 续约
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, r.Register(ctx, si))
+	assert.Equal(t, registry.EventTypeUpdate, (<-events).Type)
+	time.Sleep(60 * time.Millisecond)
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	// 过期后被摘除并通知
+	select {
+	case event := <-events:
+		assert.Equal(t, registry.EventTypeDelete, event.Type)
+	case <-time.After(time.Second):
+		t.Fatal("未收到过期事件")
+	}
+	got, err = r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Len(t, got, 0)
+}
+
+func TestRegistry_Discovery(t *testing.T) {
+	r := NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+
+	server, err := micro.NewServer("user-service", micro.ServerWithRegister(r))
+	require.NoError(t, err)
+	proto.RegisterUserServiceServer(server, &UserServer{})
+	go func() {
+		_ = server.Start("127.0.0.1:0")
+	}()
+	defer server.GracefulStop()
+
+	require.Eventually(t, func() bool {
+		instances, er := r.ListServices(context.Background(), "user-service")
+		return er == nil && len(instances) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	client, err := micro.NewClient(
+		micro.ClientInsecure(),
+		micro.ClientWithRegistry(r, time.Second),
+	)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cc, err := client.Dial(ctx, "user-service")
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	resp, err := proto.NewUserServiceClient(cc).GetByID(ctx, &proto.Request{Id: 123})
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), resp.User.Id)
+}
+
+type UserServer struct {
+	proto.UnimplementedUserServiceServer
+}
+
+func (s *UserServer) GetByID(ctx context.Context, request *proto.Request) (*proto.Response, error) {
+	return &proto.Response{
+		User: &proto.User{
+			Id:   request.Id,
+			Name: "hello,world",
+		},
+	}, nil
+}
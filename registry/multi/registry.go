@@ -0,0 +1,354 @@
+package multi
+
+import (
+	"errors"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"sync"
+	"time"
+)
+
+// Policy 同一个地址出现在多个注册中心时，决定使用哪一个实例
+// candidates 按注册中心的顺序排列，不存在的位置为nil，全部为nil时应返回nil
+type Policy func(candidates []*registry.ServiceInstance) *registry.ServiceInstance
+
+// PreferFirst 以靠前的注册中心为准
+func PreferFirst(candidates []*registry.ServiceInstance) *registry.ServiceInstance {
+	for _, si := range candidates {
+		if si != nil {
+			return si
+		}
+	}
+	return nil
+}
+
+// PreferLast 以靠后的注册中心为准，迁移时把新注册中心放在最后即可切换读优先级
+func PreferLast(candidates []*registry.ServiceInstance) *registry.ServiceInstance {
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if candidates[i] != nil {
+			return candidates[i]
+		}
+	}
+	return nil
+}
+
+// Registry 聚合多个注册中心
+// 注册写入所有注册中心，查询和订阅合并去重所有注册中心的结果
+type Registry struct {
+	registries []registry.Registry
+	policy     Policy
+	timeout    time.Duration
+	close      chan struct{}
+	once       sync.Once
+}
+
+type RegistryOption func(r *Registry)
+
+// RegistryWithPolicy 冲突时的优先级策略，默认 PreferFirst
+func RegistryWithPolicy(policy Policy) RegistryOption {
+	return func(r *Registry) {
+		r.policy = policy
+	}
+}
+
+// RegistryWithTimeout 订阅时拉取初始实例的超时时间，默认3s
+func RegistryWithTimeout(timeout time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.timeout = timeout
+	}
+}
+
+func NewRegistry(registries []registry.Registry, opts ...RegistryOption) (*Registry, error) {
+	if len(registries) == 0 {
+		return nil, errors.New("micro: 至少需要一个注册中心")
+	}
+
+	res := &Registry{
+		registries: registries,
+		policy:     PreferFirst,
+		timeout:    3 * time.Second,
+		close:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res, nil
+}
+
+// Register 注册到所有注册中心，任意一个失败都返回错误
+// 失败时从已经注册成功的注册中心中撤销，避免只在部分注册中心中出现没有启动的服务
+func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	var errs []error
+	succeeded := make([]registry.Registry, 0, len(r.registries))
+	for _, reg := range r.registries {
+		if err := reg.Register(ctx, service); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		succeeded = append(succeeded, reg)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, reg := range succeeded {
+		if err := reg.UnRegister(ctx, service); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Registry) UnRegister(ctx context.Context, service *registry.ServiceInstance) error {
+	var errs []error
+	for _, reg := range r.registries {
+		if err := reg.UnRegister(ctx, service); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListServices 合并所有注册中心的结果，只有全部失败时才返回错误
+func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	v := newView(len(r.registries), r.policy)
+	var errs []error
+	for i, reg := range r.registries {
+		instances, err := reg.ListServices(ctx, serviceName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v.reset(i, instances)
+	}
+	if len(errs) == len(r.registries) {
+		return nil, errors.Join(errs...)
+	}
+	return v.list(), nil
+}
+
+func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	sources := make([]<-chan registry.Event, len(r.registries))
+	var errs []error
+	for i, reg := range r.registries {
+		ch, err := reg.Subscribe(serviceName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sources[i] = ch
+	}
+	if len(errs) == len(r.registries) {
+		return nil, errors.Join(errs...)
+	}
+
+	// 拉取初始实例，之后的事件才能正确去重
+	v := newView(len(r.registries), r.policy)
+	for i := range r.registries {
+		if sources[i] != nil {
+			r.reload(v, i, serviceName)
+		}
+	}
+
+	// 订阅失败的注册中心也启动forward，恢复后重新订阅并拉取
+	merged := make(chan sourceEvent)
+	for i, ch := range sources {
+		go r.forward(i, serviceName, ch, merged)
+	}
+
+	res := make(chan registry.Event)
+	go func() {
+		defer close(res)
+		var revision int64
+		for {
+			select {
+			case se := <-merged:
+				var events []registry.Event
+				if se.event.Instance == nil {
+					// 不知道具体变更，重新拉取该注册中心并让订阅方全量刷新
+					r.reload(v, se.index, serviceName)
+					events = []registry.Event{{Type: registry.EventTypeUnknown}}
+				} else {
+					events = v.apply(se.index, se.event)
+				}
+
+				for _, event := range events {
+					revision++
+					event.Revision = revision
+					select {
+					case res <- event:
+					case <-r.close:
+						return
+					}
+				}
+			case <-r.close:
+				return
+			}
+		}
+	}()
+	return res, nil
+}
+
+func (r *Registry) Close() error {
+	r.once.Do(func() {
+		close(r.close)
+	})
+
+	var errs []error
+	for _, reg := range r.registries {
+		if err := reg.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forward 转发一个注册中心的事件，订阅中断时重新订阅
+// ch为nil表示订阅时该注册中心不可用，先重新订阅
+func (r *Registry) forward(index int, serviceName string, ch <-chan registry.Event, merged chan<- sourceEvent) {
+	for {
+		var event registry.Event
+		if ch == nil {
+			if ch = r.resubscribe(index, serviceName); ch == nil {
+				return
+			}
+			// 中断期间的变更未知，重新拉取该注册中心
+			event = registry.Event{Type: registry.EventTypeUnknown}
+		} else {
+			var ok bool
+			select {
+			case event, ok = <-ch:
+				if !ok {
+					ch = nil
+					continue
+				}
+			case <-r.close:
+				return
+			}
+		}
+
+		select {
+		case merged <- sourceEvent{index: index, event: event}:
+		case <-r.close:
+			return
+		}
+	}
+}
+
+// resubscribeInterval 重新订阅失败后的重试间隔
+var resubscribeInterval = time.Second
+
+// resubscribe 直到订阅成功，注册中心关闭时返回nil
+func (r *Registry) resubscribe(index int, serviceName string) <-chan registry.Event {
+	for {
+		ch, err := r.registries[index].Subscribe(serviceName)
+		if err == nil {
+			return ch
+		}
+		select {
+		case <-time.After(resubscribeInterval):
+		case <-r.close:
+			return nil
+		}
+	}
+}
+
+func (r *Registry) reload(v *view, index int, serviceName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	instances, err := r.registries[index].ListServices(ctx, serviceName)
+	if err != nil {
+		return
+	}
+	v.reset(index, instances)
+}
+
+type sourceEvent struct {
+	index int
+	event registry.Event
+}
+
+// view 按地址记录每个注册中心中的实例
+type view struct {
+	size      int
+	policy    Policy
+	instances map[string][]*registry.ServiceInstance
+}
+
+func newView(size int, policy Policy) *view {
+	return &view{
+		size:      size,
+		policy:    policy,
+		instances: make(map[string][]*registry.ServiceInstance, 8),
+	}
+}
+
+// reset 用全量结果替换某个注册中心的实例
+func (v *view) reset(index int, instances []*registry.ServiceInstance) {
+	for addr, candidates := range v.instances {
+		candidates[index] = nil
+		if v.policy(candidates) == nil {
+			delete(v.instances, addr)
+		}
+	}
+	for _, si := range instances {
+		v.set(index, si.Address, si)
+	}
+}
+
+// apply 应用某个注册中心的事件，返回合并后对外可见的变更
+func (v *view) apply(index int, event registry.Event) []registry.Event {
+	addr := event.Instance.Address
+	before := v.effective(addr)
+
+	switch event.Type {
+	case registry.EventTypeDelete:
+		v.set(index, addr, nil)
+	default:
+		v.set(index, addr, event.Instance)
+	}
+
+	after := v.effective(addr)
+	switch {
+	case before == nil && after != nil:
+		return []registry.Event{{Type: registry.EventTypeAdd, Instance: after}}
+	case before != nil && after == nil:
+		return []registry.Event{{Type: registry.EventTypeDelete, Instance: before}}
+	case before != after:
+		return []registry.Event{{Type: registry.EventTypeUpdate, Instance: after}}
+	default:
+		return nil
+	}
+}
+
+func (v *view) set(index int, addr string, si *registry.ServiceInstance) {
+	candidates, ok := v.instances[addr]
+	if !ok {
+		if si == nil {
+			return
+		}
+		candidates = make([]*registry.ServiceInstance, v.size)
+		v.instances[addr] = candidates
+	}
+	candidates[index] = si
+	if v.policy(candidates) == nil {
+		delete(v.instances, addr)
+	}
+}
+
+func (v *view) effective(addr string) *registry.ServiceInstance {
+	candidates, ok := v.instances[addr]
+	if !ok {
+		return nil
+	}
+	return v.policy(candidates)
+}
+
+func (v *view) list() []*registry.ServiceInstance {
+	res := make([]*registry.ServiceInstance, 0, len(v.instances))
+	for _, candidates := range v.instances {
+		if si := v.policy(candidates); si != nil {
+			res = append(res, si)
+		}
+	}
+	return res
+}
@@ -0,0 +1,188 @@
+package multi
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"micro/registry/memory"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ListServices(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []*registry.ServiceInstance
+	}{
+		{
+			name:   "prefer first",
+			policy: PreferFirst,
+			want: []*registry.ServiceInstance{
+				{Name: "user-service", Address: "127.0.0.1:8080", Group: "old"},
+			},
+		},
+		{
+			name:   "prefer last",
+			policy: PreferLast,
+			want: []*registry.ServiceInstance{
+				{Name: "user-service", Address: "127.0.0.1:8080", Group: "new"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, latest := memory.NewRegistry(), memory.NewRegistry()
+			r, err := NewRegistry([]registry.Registry{old, latest}, RegistryWithPolicy(tt.policy))
+			require.NoError(t, err)
+			defer func() {
+				_ = r.Close()
+			}()
+
+			require.NoError(t, old.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080", Group: "old"}))
+			require.NoError(t, latest.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080", Group: "new"}))
+
+			got, err := r.ListServices(ctx, "user-service")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	ctx := context.Background()
+	old, latest := memory.NewRegistry(), memory.NewRegistry()
+	r, err := NewRegistry([]registry.Registry{old, latest})
+	require.NoError(t, err)
+
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, r.Register(ctx, si))
+	for _, reg := range []registry.Registry{old, latest} {
+		got, er := reg.ListServices(ctx, "user-service")
+		require.NoError(t, er)
+		assert.Equal(t, []*registry.ServiceInstance{si}, got)
+	}
+
+	// 一个注册中心不可用时仍然能查询
+	require.NoError(t, old.Close())
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{si}, got)
+
+	// 注册失败会返回错误，并从注册成功的注册中心中撤销
+	assert.Error(t, r.Register(ctx, si))
+	got, err = latest.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	require.NoError(t, r.Close())
+	_, err = r.ListServices(ctx, "user-service")
+	assert.Error(t, err)
+}
+
+func TestRegistry_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	old, latest := memory.NewRegistry(), memory.NewRegistry()
+	r, err := NewRegistry([]registry.Registry{old, latest})
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+
+	events, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, old.Register(ctx, si))
+	event := receive(t, events)
+	assert.Equal(t, registry.EventTypeAdd, event.Type)
+	assert.Equal(t, si, event.Instance)
+
+	// 另一个注册中心的重复实例不产生事件
+	require.NoError(t, latest.Register(ctx, si))
+	// 不同注册中心之间的事件没有顺序保证，等待上一个事件处理完
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, old.UnRegister(ctx, si))
+	// 优先的注册中心摘除后，以另一个注册中心为准
+	event = receive(t, events)
+	assert.Equal(t, registry.EventTypeUpdate, event.Type)
+
+	// 全部摘除才删除
+	require.NoError(t, latest.UnRegister(ctx, si))
+	event = receive(t, events)
+	assert.Equal(t, registry.EventTypeDelete, event.Type)
+	assert.Equal(t, si.Address, event.Instance.Address)
+
+	select {
+	case event = <-events:
+		t.Fatal("多余的事件", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 关闭后channel被关闭
+	require.NoError(t, r.Close())
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel未关闭")
+	}
+}
+
+// failOnceRegistry 第一次订阅失败
+type failOnceRegistry struct {
+	registry.Registry
+	failed atomic.Bool
+}
+
+func (f *failOnceRegistry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	if f.failed.CompareAndSwap(false, true) {
+		return nil, errors.New("mock: 注册中心不可用")
+	}
+	return f.Registry.Subscribe(serviceName)
+}
+
+func TestRegistry_SubscribeRecover(t *testing.T) {
+	interval := resubscribeInterval
+	resubscribeInterval = 10 * time.Millisecond
+	defer func() {
+		resubscribeInterval = interval
+	}()
+	ctx := context.Background()
+	old, latest := memory.NewRegistry(), memory.NewRegistry()
+	r, err := NewRegistry([]registry.Registry{old, &failOnceRegistry{Registry: latest}})
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+
+	// 第二个注册中心订阅时不可用，恢复后重新拉取
+	si := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	require.NoError(t, latest.Register(ctx, si))
+	events, err := r.Subscribe("user-service")
+	require.NoError(t, err)
+	event := receive(t, events)
+	assert.Equal(t, registry.EventTypeUnknown, event.Type)
+
+	// 之后的变更正常转发
+	other := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8081"}
+	require.NoError(t, latest.Register(ctx, other))
+	event = receive(t, events)
+	assert.Equal(t, registry.EventTypeAdd, event.Type)
+	assert.Equal(t, other, event.Instance)
+}
+
+func receive(t *testing.T, events <-chan registry.Event) registry.Event {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("未收到变更事件")
+	}
+	return registry.Event{}
+}
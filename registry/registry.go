@@ -17,7 +17,41 @@ type ServiceInstance struct {
 	Name    string
 	Address string
 	Group   string
+	// Weight 权重，0表示使用 DefaultWeight
+	Weight  uint32
+	Version string
+	Zone    string
+	Tags    []string
 	Meta    map[string]string
 }
 
-type Event struct{}
+type EventType int
+
+const (
+	EventTypeUnknown EventType = iota
+	EventTypeAdd
+	EventTypeUpdate
+	EventTypeDelete
+)
+
+func (e EventType) String() string {
+	switch e {
+	case EventTypeAdd:
+		return "add"
+	case EventTypeUpdate:
+		return "update"
+	case EventTypeDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Event 服务变更事件
+// Instance 为nil时订阅方无法得知具体变更，需要重新拉取全量实例
+type Event struct {
+	Type     EventType
+	Instance *ServiceInstance
+	// Revision 变更版本号，单调递增，0表示注册中心不支持版本
+	Revision int64
+}
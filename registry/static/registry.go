@@ -0,0 +1,177 @@
+package static
+
+import (
+	"encoding/json"
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v3"
+	"micro/registry"
+	"micro/registry/memory"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Registry 基于静态列表或本地文件的只读注册中心
+// 文件支持json和yaml（按扩展名区分），内容为实例列表，修改后自动重新加载
+type Registry struct {
+	store    *memory.Registry
+	path     string
+	interval time.Duration
+	onError  func(err error)
+
+	// current 当前已加载的实例，key为服务名
+	current map[string][]*registry.ServiceInstance
+	modTime time.Time
+	size    int64
+
+	close chan struct{}
+	once  sync.Once
+}
+
+type RegistryOption func(r *Registry)
+
+// RegistryWithInterval 检查文件变化的间隔，默认5s
+func RegistryWithInterval(interval time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.interval = interval
+	}
+}
+
+// RegistryWithErrorHandler 重新加载失败时回调，失败时保留上一次的内容
+func RegistryWithErrorHandler(fn func(err error)) RegistryOption {
+	return func(r *Registry) {
+		r.onError = fn
+	}
+}
+
+// NewRegistry 静态实例列表
+func NewRegistry(instances ...*registry.ServiceInstance) *Registry {
+	res := &Registry{
+		store:   memory.NewRegistry(),
+		current: make(map[string][]*registry.ServiceInstance, 8),
+		close:   make(chan struct{}),
+	}
+	res.update(instances)
+	return res
+}
+
+// NewFileRegistry 从本地文件加载实例列表，并监听文件变化
+func NewFileRegistry(path string, opts ...RegistryOption) (*Registry, error) {
+	res := &Registry{
+		store:    memory.NewRegistry(),
+		path:     path,
+		interval: 5 * time.Second,
+		current:  make(map[string][]*registry.ServiceInstance, 8),
+		close:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	if _, err := res.reload(); err != nil {
+		return nil, err
+	}
+	go res.watch()
+	return res, nil
+}
+
+func (r *Registry) Register(ctx context.Context, service *registry.ServiceInstance) error {
+	return registry.ErrReadOnly
+}
+
+func (r *Registry) UnRegister(ctx context.Context, service *registry.ServiceInstance) error {
+	return registry.ErrReadOnly
+}
+
+func (r *Registry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	return r.store.ListServices(ctx, serviceName)
+}
+
+func (r *Registry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	return r.store.Subscribe(serviceName)
+}
+
+func (r *Registry) Close() error {
+	r.once.Do(func() {
+		close(r.close)
+	})
+	return r.store.Close()
+}
+
+// watch 轮询文件的修改时间和大小
+func (r *Registry) watch() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := r.reload(); err != nil && r.onError != nil {
+				r.onError(err)
+			}
+		case <-r.close:
+			return
+		}
+	}
+}
+
+// reload 文件有变化时重新加载，返回是否重新加载
+func (r *Registry) reload() (bool, error) {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return false, err
+	}
+	var instances []*registry.ServiceInstance
+	switch filepath.Ext(r.path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &instances)
+	default:
+		err = json.Unmarshal(data, &instances)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	r.update(instances)
+	return true, nil
+}
+
+// update 与当前内容比较，只把变化写入store，订阅方只收到真正的变更
+func (r *Registry) update(instances []*registry.ServiceInstance) {
+	services := make(map[string][]*registry.ServiceInstance, len(r.current))
+	for _, si := range instances {
+		services[si.Name] = append(services[si.Name], si)
+	}
+	for name := range r.current {
+		if _, ok := services[name]; !ok {
+			services[name] = nil
+		}
+	}
+
+	ctx := context.Background()
+	for name, cur := range services {
+		for _, event := range registry.Diff(r.current[name], cur) {
+			switch event.Type {
+			case registry.EventTypeDelete:
+				_ = r.store.UnRegister(ctx, event.Instance)
+			default:
+				_ = r.store.Register(ctx, event.Instance)
+			}
+		}
+		if len(cur) == 0 {
+			delete(r.current, name)
+			continue
+		}
+		r.current[name] = cur
+	}
+}
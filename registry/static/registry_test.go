@@ -0,0 +1,139 @@
+package static
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"micro/registry"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ListServices(t *testing.T) {
+	r := NewRegistry(
+		&registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"},
+		&registry.ServiceInstance{Name: "order-service", Address: "127.0.0.1:8081"},
+	)
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	got, err := r.ListServices(ctx, "user-service")
+	require.NoError(t, err)
+	assert.Equal(t, []*registry.ServiceInstance{{Name: "user-service", Address: "127.0.0.1:8080"}}, got)
+	assert.Equal(t, registry.ErrReadOnly, r.Register(ctx, got[0]))
+	assert.Equal(t, registry.ErrReadOnly, r.UnRegister(ctx, got[0]))
+}
+
+func TestNewFileRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		update  string
+	}{
+		{
+			name: "json",
+			file: "registry.json",
+			content: `[{"name": "user-service", "address": "127.0.0.1:8080", "group": "A", "weight": 20},
+				{"name": "user-service", "address": "127.0.0.1:8081"}]`,
+			update: `[{"name": "user-service", "address": "127.0.0.1:8080", "group": "A", "weight": 20},
+				{"name": "user-service", "address": "127.0.0.1:8082"}]`,
+		},
+		{
+			name: "yaml",
+			file: "registry.yaml",
+			content: `
+- name: user-service
+  address: 127.0.0.1:8080
+  group: A
+  weight: 20
+- name: user-service
+  address: 127.0.0.1:8081
+`,
+			update: `
+- name: user-service
+  address: 127.0.0.1:8080
+  group: A
+  weight: 20
+- name: user-service
+  address: 127.0.0.1:8082
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			r, err := NewFileRegistry(path, RegistryWithInterval(10*time.Millisecond))
+			require.NoError(t, err)
+			defer func() {
+				_ = r.Close()
+			}()
+			ctx := context.Background()
+
+			got, err := r.ListServices(ctx, "user-service")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []*registry.ServiceInstance{
+				{Name: "user-service", Address: "127.0.0.1:8080", Group: "A", Weight: 20},
+				{Name: "user-service", Address: "127.0.0.1:8081"},
+			}, got)
+
+			events, err := r.Subscribe("user-service")
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, []byte(tt.update), 0o644))
+
+			// 只有变化的实例产生事件
+			var changes []registry.Event
+			for i := 0; i < 2; i++ {
+				select {
+				case event := <-events:
+					changes = append(changes, event)
+				case <-time.After(time.Second):
+					t.Fatal("未收到变更事件")
+				}
+			}
+			assert.Equal(t, registry.EventTypeDelete, changes[0].Type)
+			assert.Equal(t, "127.0.0.1:8081", changes[0].Instance.Address)
+			assert.Equal(t, registry.EventTypeAdd, changes[1].Type)
+			assert.Equal(t, "127.0.0.1:8082", changes[1].Instance.Address)
+		})
+	}
+}
+
+func TestNewFileRegistry_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": "user-service", "address": "127.0.0.1:8080"}]`), 0o644))
+
+	errs := make(chan error, 1)
+	r, err := NewFileRegistry(path, RegistryWithInterval(10*time.Millisecond), RegistryWithErrorHandler(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+	require.NoError(t, err)
+	defer func() {
+		_ = r.Close()
+	}()
+
+	// 格式错误时保留上一次的内容
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name": `), 0o644))
+	select {
+	case err = <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("未回调错误")
+	}
+	got, err := r.ListServices(context.Background(), "user-service")
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	_, err = NewFileRegistry(filepath.Join(t.TempDir(), "not-exist.json"))
+	assert.Error(t, err)
+}
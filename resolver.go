@@ -2,7 +2,6 @@ package micro
 
 import (
 	"context"
-	"google.golang.org/grpc/attributes"
 	"google.golang.org/grpc/resolver"
 	"micro/registry"
 	"sync"
@@ -23,15 +22,24 @@ func NewRegistryBuilder(r registry.Registry, timeout time.Duration) (*RegistryBu
 
 func (r *RegistryBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
 	res := &RegistryResolver{
-		cc:       cc,
-		registry: r.registry,
-		target:   target,
-		timeout:  r.timeout,
+		cc:         cc,
+		registry:   r.registry,
+		target:     target,
+		timeout:    r.timeout,
+		instances:  make(map[string]*registry.ServiceInstance, 8),
+		resolveNow: make(chan struct{}, 1),
+		close:      make(chan struct{}),
 	}
-	res.ResolveNow(resolver.ResolveNowOptions{})
+
+	// 先订阅再拉取全量，避免两者之间的变更丢失
+	events, err := r.registry.Subscribe(target.Endpoint())
+	if err != nil {
+		return nil, err
+	}
+	res.resolve()
 
 	go func() {
-		res.watch()
+		res.watch(events)
 	}()
 
 	return res, nil
@@ -46,13 +54,29 @@ type RegistryResolver struct {
 	registry registry.Registry
 	target   resolver.Target
 	timeout  time.Duration
-	close    chan struct{}
+
+	// instances 当前已知的实例，key为地址
+	instances map[string]*registry.ServiceInstance
+	// revision 最后应用的事件版本号，只在一次订阅内比较
+	// multi、dns 等注册中心每次订阅都从1开始，重新订阅和全量拉取后清零
+	revision int64
+	mutex    sync.Mutex
+	// resolveNow 全量拉取和应用事件都在watch中执行，拉取期间不会有事件被覆盖
+	resolveNow chan struct{}
+
+	close chan struct{}
+	once  sync.Once
 }
 
+// ResolveNow grpc在自己的goroutine中调用，交给watch执行，已经有待执行的请求时合并
 func (r *RegistryResolver) ResolveNow(options resolver.ResolveNowOptions) {
-	r.resolve()
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
 }
 
+// resolve 全量拉取实例
 func (r *RegistryResolver) resolve() {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
@@ -63,35 +87,76 @@ func (r *RegistryResolver) resolve() {
 		return
 	}
 
-	address := make([]resolver.Address, 0, len(instances))
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.revision = 0
+	r.instances = make(map[string]*registry.ServiceInstance, len(instances))
 	for _, si := range instances {
+		r.instances[si.Address] = si
+	}
+	r.updateState()
+}
+
+// apply 增量更新实例
+func (r *RegistryResolver) apply(event registry.Event) {
+	// 不知道具体变更，退化为全量拉取
+	if event.Instance == nil || event.Type == registry.EventTypeUnknown {
+		r.resolve()
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// 过期事件，同一个事务中的多个变更（如租约过期删除多个实例）版本号相同
+	if event.Revision != 0 && event.Revision < r.revision {
+		return
+	}
+	r.revision = event.Revision
+
+	switch event.Type {
+	case registry.EventTypeAdd, registry.EventTypeUpdate:
+		r.instances[event.Instance.Address] = event.Instance
+	case registry.EventTypeDelete:
+		delete(r.instances, event.Instance.Address)
+	}
+	r.updateState()
+}
+
+// updateState 推送实例到grpc，调用方需持有锁
+func (r *RegistryResolver) updateState() {
+	address := make([]resolver.Address, 0, len(r.instances))
+	for _, si := range r.instances {
 		address = append(address, resolver.Address{
 			Addr:       si.Address,
-			Attributes: attributes.New("group", si.Group),
+			Attributes: si.Attributes(),
 		})
 	}
 
-	err = r.cc.UpdateState(resolver.State{
+	err := r.cc.UpdateState(resolver.State{
 		Addresses: address,
 	})
 	if err != nil {
 		r.cc.ReportError(err)
-		return
 	}
 }
 
-func (r *RegistryResolver) watch() {
-	events, err := r.registry.Subscribe(r.target.Endpoint())
-	if err != nil {
-		r.cc.ReportError(err)
-		return
-	}
-
+func (r *RegistryResolver) watch(events <-chan registry.Event) {
 	// 监听events
 	for {
 		select {
-		case <-events:
+		case event, ok := <-events:
+			if !ok {
+				// 订阅中断，重新订阅并全量拉取，期间的变更不会丢失
+				if events = r.resubscribe(); events == nil {
+					return
+				}
+				r.resolve()
+				continue
+			}
 			// 服务变更事件
+			r.apply(event)
+		case <-r.resolveNow:
 			r.resolve()
 		case <-r.close:
 			// 退出
@@ -100,11 +165,31 @@ func (r *RegistryResolver) watch() {
 	}
 }
 
-func (r *RegistryResolver) Close() {
-	fn := func() {
-		close(r.close)
+// resubscribeInterval 重新订阅失败后的重试间隔
+var resubscribeInterval = time.Second
+
+// resubscribe 直到订阅成功，resolver关闭时返回nil
+func (r *RegistryResolver) resubscribe() <-chan registry.Event {
+	for {
+		events, err := r.registry.Subscribe(r.target.Endpoint())
+		if err == nil {
+			r.mutex.Lock()
+			r.revision = 0
+			r.mutex.Unlock()
+			return events
+		}
+		r.cc.ReportError(err)
+
+		select {
+		case <-time.After(resubscribeInterval):
+		case <-r.close:
+			return nil
+		}
 	}
+}
 
-	once := sync.Once{}
-	once.Do(fn)
+func (r *RegistryResolver) Close() {
+	r.once.Do(func() {
+		close(r.close)
+	})
 }
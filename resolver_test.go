@@ -0,0 +1,239 @@
+package micro
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/resolver"
+	"micro/registry"
+	"micro/registry/memory"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistryResolver_Watch(t *testing.T) {
+	r := memory.NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+	require.NoError(t, r.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}))
+
+	builder, err := NewRegistryBuilder(r, time.Second)
+	require.NoError(t, err)
+	cc := &mockClientConn{}
+	res, err := builder.Build(resolver.Target{URL: url.URL{Scheme: "registry", Path: "/user-service"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer res.Close()
+	assert.Equal(t, []string{"127.0.0.1:8080"}, cc.addresses())
+
+	// 新增
+	require.NoError(t, r.Register(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8081"}))
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"127.0.0.1:8080", "127.0.0.1:8081"}, cc.addresses())
+	}, time.Second, 10*time.Millisecond)
+
+	// 删除
+	require.NoError(t, r.UnRegister(ctx, &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}))
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"127.0.0.1:8081"}, cc.addresses())
+	}, time.Second, 10*time.Millisecond)
+}
+
+type mockClientConn struct {
+	resolver.ClientConn
+	state resolver.State
+	mutex sync.Mutex
+}
+
+func (m *mockClientConn) UpdateState(state resolver.State) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.state = state
+	return nil
+}
+
+func (m *mockClientConn) ReportError(err error) {}
+
+func (m *mockClientConn) addresses() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	res := make([]string, 0, len(m.state.Addresses))
+	for _, addr := range m.state.Addresses {
+		res = append(res, addr.Addr)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestRegistryResolver_Attributes(t *testing.T) {
+	r := memory.NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+	require.NoError(t, r.Register(context.Background(), &registry.ServiceInstance{
+		Name:    "user-service",
+		Address: "127.0.0.1:8080",
+		Group:   "A",
+		Weight:  20,
+		Version: "v1",
+		Zone:    "cn-east",
+		Tags:    []string{"canary"},
+		Meta:    map[string]string{"owner": "user-team"},
+	}))
+
+	builder, err := NewRegistryBuilder(r, time.Second)
+	require.NoError(t, err)
+	cc := &mockClientConn{}
+	res, err := builder.Build(resolver.Target{URL: url.URL{Scheme: "registry", Path: "/user-service"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer res.Close()
+
+	require.Len(t, cc.state.Addresses, 1)
+	attrs := cc.state.Addresses[0].Attributes
+	assert.Equal(t, "A", attrs.Value(registry.AttributeGroup))
+	assert.Equal(t, uint32(20), registry.WeightOf(attrs))
+	assert.Equal(t, "v1", attrs.Value(registry.AttributeVersion))
+	assert.Equal(t, "cn-east", attrs.Value(registry.AttributeZone))
+	assert.Equal(t, registry.Tags{"canary"}, attrs.Value(registry.AttributeTags))
+	assert.Equal(t, registry.Meta{"owner": "user-team"}, attrs.Value(registry.AttributeMeta))
+
+	// 相同实例的attribute可比较
+	assert.True(t, attrs.Equal((&registry.ServiceInstance{
+		Group:   "A",
+		Weight:  20,
+		Version: "v1",
+		Zone:    "cn-east",
+		Tags:    []string{"canary"},
+		Meta:    map[string]string{"owner": "user-team"},
+	}).Attributes()))
+
+	// 未设置权重时使用默认权重
+	assert.Equal(t, registry.DefaultWeight, registry.WeightOf(nil))
+}
+
+// subscribeRegistry 由测试控制订阅的channel
+type subscribeRegistry struct {
+	*memory.Registry
+	subs chan chan registry.Event
+}
+
+func (r *subscribeRegistry) Subscribe(serviceName string) (<-chan registry.Event, error) {
+	ch := make(chan registry.Event)
+	r.subs <- ch
+	return ch, nil
+}
+
+func TestRegistryResolver_Resubscribe(t *testing.T) {
+	r := &subscribeRegistry{Registry: memory.NewRegistry(), subs: make(chan chan registry.Event, 2)}
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+	a := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	b := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8081"}
+	require.NoError(t, r.Register(ctx, a))
+	require.NoError(t, r.Register(ctx, b))
+
+	builder, err := NewRegistryBuilder(r, time.Second)
+	require.NoError(t, err)
+	cc := &mockClientConn{}
+	res, err := builder.Build(resolver.Target{URL: url.URL{Scheme: "registry", Path: "/user-service"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer res.Close()
+	events := <-r.subs
+	assert.Equal(t, []string{"127.0.0.1:8080", "127.0.0.1:8081"}, cc.addresses())
+
+	// 同一个租约下的实例在一个事务中删除，版本号相同
+	events <- registry.Event{Type: registry.EventTypeDelete, Instance: a, Revision: 10}
+	events <- registry.Event{Type: registry.EventTypeDelete, Instance: b, Revision: 10}
+	require.Eventually(t, func() bool {
+		return len(cc.addresses()) == 0
+	}, time.Second, 10*time.Millisecond)
+	// 过期事件
+	events <- registry.Event{Type: registry.EventTypeAdd, Instance: a, Revision: 9}
+
+	// 订阅中断，重新订阅后全量拉取
+	require.NoError(t, r.UnRegister(ctx, b))
+	close(events)
+	select {
+	case events = <-r.subs:
+	case <-time.After(time.Second):
+		t.Fatal("没有重新订阅")
+	}
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"127.0.0.1:8080"}, cc.addresses())
+	}, time.Second, 10*time.Millisecond)
+
+	// 新的订阅版本号从头开始，不能当作过期事件丢弃
+	events <- registry.Event{Type: registry.EventTypeAdd, Instance: b, Revision: 1}
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"127.0.0.1:8080", "127.0.0.1:8081"}, cc.addresses())
+	}, time.Second, 10*time.Millisecond)
+	events <- registry.Event{Type: registry.EventTypeDelete, Instance: a, Revision: 2}
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"127.0.0.1:8081"}, cc.addresses())
+	}, time.Second, 10*time.Millisecond)
+}
+
+// blockingRegistry 开启后 ListServices 拿到结果后等待放行，模拟拉取期间收到事件
+type blockingRegistry struct {
+	*subscribeRegistry
+	block   atomic.Bool
+	listed  chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRegistry) ListServices(ctx context.Context, serviceName string) ([]*registry.ServiceInstance, error) {
+	res, err := r.subscribeRegistry.ListServices(ctx, serviceName)
+	if r.block.Load() {
+		r.listed <- struct{}{}
+		<-r.release
+	}
+	return res, err
+}
+
+func TestRegistryResolver_ResolveNowRace(t *testing.T) {
+	r := &blockingRegistry{
+		subscribeRegistry: &subscribeRegistry{Registry: memory.NewRegistry(), subs: make(chan chan registry.Event, 1)},
+		listed:            make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	a := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8080"}
+	b := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:8081"}
+	require.NoError(t, r.Register(context.Background(), a))
+
+	builder, err := NewRegistryBuilder(r, time.Second)
+	require.NoError(t, err)
+	cc := &mockClientConn{}
+	res, err := builder.Build(resolver.Target{URL: url.URL{Scheme: "registry", Path: "/user-service"}}, cc, resolver.BuildOptions{})
+	require.NoError(t, err)
+	defer res.Close()
+	events := <-r.subs
+
+	// grpc调用ResolveNow，拉取到的结果中还没有b
+	r.block.Store(true)
+	go res.ResolveNow(resolver.ResolveNowOptions{})
+	<-r.listed
+	// 拉取期间收到新增b的事件，不能被拉取的结果覆盖
+	sent := make(chan struct{})
+	go func() {
+		events <- registry.Event{Type: registry.EventTypeAdd, Instance: b, Revision: 5}
+		close(sent)
+	}()
+	// 给事件被处理的机会
+	time.Sleep(50 * time.Millisecond)
+	r.block.Store(false)
+	close(r.release)
+	<-sent
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"127.0.0.1:8080", "127.0.0.1:8081"}, cc.addresses())
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package route
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Keys 请求的路由key，通过 WithGroup 等方法放入context
+// 配合 ClientMiddleware 和 ServerMiddleware 随metadata传给下游，整条调用链使用相同的路由
+type Keys struct {
+	Group   string
+	Version string
+	Zone    string
+	// Tags 节点需要包含所有的标签
+	Tags []string
+	// Meta 节点元数据需要包含所有的键值对
+	Meta map[string]string
+}
+
+func (k Keys) IsZero() bool {
+	return k.Group == "" && k.Version == "" && k.Zone == "" && len(k.Tags) == 0 && len(k.Meta) == 0
+}
+
+// clone 避免修改上游context中的Keys
+func (k Keys) clone() Keys {
+	res := k
+	res.Tags = append([]string(nil), k.Tags...)
+	if k.Meta != nil {
+		res.Meta = make(map[string]string, len(k.Meta))
+		for key, value := range k.Meta {
+			res.Meta[key] = value
+		}
+	}
+	return res
+}
+
+type keysKey struct{}
+
+// NewContext 替换context中的所有路由key
+func NewContext(ctx context.Context, keys Keys) context.Context {
+	return context.WithValue(ctx, keysKey{}, keys)
+}
+
+// FromContext 没有设置时返回零值
+func FromContext(ctx context.Context) Keys {
+	if ctx == nil {
+		return Keys{}
+	}
+	keys, _ := ctx.Value(keysKey{}).(Keys)
+	return keys
+}
+
+func WithGroup(ctx context.Context, group string) context.Context {
+	keys := FromContext(ctx).clone()
+	keys.Group = group
+	return NewContext(ctx, keys)
+}
+
+func WithVersion(ctx context.Context, version string) context.Context {
+	keys := FromContext(ctx).clone()
+	keys.Version = version
+	return NewContext(ctx, keys)
+}
+
+func WithZone(ctx context.Context, zone string) context.Context {
+	keys := FromContext(ctx).clone()
+	keys.Zone = zone
+	return NewContext(ctx, keys)
+}
+
+// WithTags 追加标签
+func WithTags(ctx context.Context, tags ...string) context.Context {
+	keys := FromContext(ctx).clone()
+	keys.Tags = append(keys.Tags, tags...)
+	return NewContext(ctx, keys)
+}
+
+func WithMeta(ctx context.Context, key, value string) context.Context {
+	keys := FromContext(ctx).clone()
+	if keys.Meta == nil {
+		keys.Meta = make(map[string]string, 1)
+	}
+	keys.Meta[key] = value
+	return NewContext(ctx, keys)
+}
@@ -0,0 +1,121 @@
+package route
+
+import (
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/resolver"
+	"micro/registry"
+)
+
+// 内置的Filter：字段不为空时按字段匹配，否则按context中的路由key匹配
+// 两者都没有设置时不限制；节点缺少对应的attribute时视为空值，不会panic
+
+type GroupFilter struct {
+	Group string
+}
+
+func (g GroupFilter) Build() Filter {
+	return stringFilter(registry.AttributeGroup, g.Group, func(keys Keys) string {
+		return keys.Group
+	})
+}
+
+type VersionFilter struct {
+	Version string
+}
+
+func (v VersionFilter) Build() Filter {
+	return stringFilter(registry.AttributeVersion, v.Version, func(keys Keys) string {
+		return keys.Version
+	})
+}
+
+type ZoneFilter struct {
+	Zone string
+}
+
+func (z ZoneFilter) Build() Filter {
+	return stringFilter(registry.AttributeZone, z.Zone, func(keys Keys) string {
+		return keys.Zone
+	})
+}
+
+// TagFilter 节点需要包含所有标签
+type TagFilter struct {
+	Tags []string
+}
+
+func (t TagFilter) Build() Filter {
+	return func(info balancer.PickInfo, addr resolver.Address) bool {
+		tags := t.Tags
+		if len(tags) == 0 {
+			tags = FromContext(info.Ctx).Tags
+		}
+		if len(tags) == 0 {
+			return true
+		}
+		target, _ := value(addr.Attributes, registry.AttributeTags).(registry.Tags)
+		for _, tag := range tags {
+			if !target.Contains(tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MetaFilter 节点元数据需要包含所有键值对
+type MetaFilter struct {
+	Meta map[string]string
+}
+
+func (m MetaFilter) Build() Filter {
+	return func(info balancer.PickInfo, addr resolver.Address) bool {
+		meta := m.Meta
+		if len(meta) == 0 {
+			meta = FromContext(info.Ctx).Meta
+		}
+		if len(meta) == 0 {
+			return true
+		}
+		target, _ := value(addr.Attributes, registry.AttributeMeta).(registry.Meta)
+		for k, v := range meta {
+			if tv, ok := target[k]; !ok || tv != v {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// KeysFilter context中设置了哪些路由key就按哪些匹配
+func KeysFilter() Filter {
+	return And(
+		GroupFilter{}.Build(),
+		VersionFilter{}.Build(),
+		ZoneFilter{}.Build(),
+		TagFilter{}.Build(),
+		MetaFilter{}.Build(),
+	)
+}
+
+func stringFilter(attr, want string, fromKeys func(keys Keys) string) Filter {
+	return func(info balancer.PickInfo, addr resolver.Address) bool {
+		input := want
+		if input == "" {
+			input = fromKeys(FromContext(info.Ctx))
+		}
+		if input == "" {
+			return true
+		}
+		target, _ := value(addr.Attributes, attr).(string)
+		return target == input
+	}
+}
+
+func value(attrs *attributes.Attributes, key string) interface{} {
+	if attrs == nil {
+		return nil
+	}
+	return attrs.Value(key)
+}
@@ -0,0 +1,187 @@
+package route
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"micro/middleware"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// 路由key在metadata中的名字
+// 所有值都经过百分号编码，grpc只接受可打印ASCII的header值
+// Tags 每个tag编码后用逗号连接；Meta 每一项编码为 key=value 后用逗号连接，key保留大小写
+const (
+	HeaderGroup   = "x-route-group"
+	HeaderVersion = "x-route-version"
+	HeaderZone    = "x-route-zone"
+	HeaderTags    = "x-route-tags"
+	HeaderMeta    = "x-route-meta"
+)
+
+// ToMetadata 写入md，已有的路由key会被覆盖
+func (k Keys) ToMetadata(md metadata.MD) {
+	set := func(key, value string) {
+		if value != "" {
+			md.Set(key, value)
+		}
+	}
+	set(HeaderGroup, url.QueryEscape(k.Group))
+	set(HeaderVersion, url.QueryEscape(k.Version))
+	set(HeaderZone, url.QueryEscape(k.Zone))
+	tags := make([]string, 0, len(k.Tags))
+	for _, tag := range k.Tags {
+		tags = append(tags, url.QueryEscape(tag))
+	}
+	set(HeaderTags, strings.Join(tags, ","))
+	meta := make([]string, 0, len(k.Meta))
+	for key, value := range k.Meta {
+		meta = append(meta, url.QueryEscape(key)+"="+url.QueryEscape(value))
+	}
+	sort.Strings(meta)
+	set(HeaderMeta, strings.Join(meta, ","))
+}
+
+// items 拆分逗号连接的值，同名header有多个值时（如被代理拆开或合并）结果相同
+func items(values []string) []string {
+	var res []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item != "" {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
+
+// FromMetadata 从md中读取路由key
+func FromMetadata(md metadata.MD) Keys {
+	// 格式错误的值当作没有设置
+	get := func(key string) string {
+		values := md.Get(key)
+		if len(values) == 0 {
+			return ""
+		}
+		value, err := url.QueryUnescape(values[0])
+		if err != nil {
+			return ""
+		}
+		return value
+	}
+	res := Keys{
+		Group:   get(HeaderGroup),
+		Version: get(HeaderVersion),
+		Zone:    get(HeaderZone),
+	}
+	// 格式错误的项忽略
+	for _, item := range items(md.Get(HeaderTags)) {
+		if tag, err := url.QueryUnescape(item); err == nil {
+			res.Tags = append(res.Tags, tag)
+		}
+	}
+	for _, item := range items(md.Get(HeaderMeta)) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			continue
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			continue
+		}
+		if res.Meta == nil {
+			res.Meta = make(map[string]string)
+		}
+		res.Meta[key] = value
+	}
+	return res
+}
+
+// ClientMiddleware 把context中的路由key写入outgoing metadata
+func ClientMiddleware() middleware.ClientMiddleware {
+	return func(handler middleware.ClientHandler) middleware.ClientHandler {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return handler(outgoing(ctx), method, req, reply, cc, opts...)
+		}
+	}
+}
+
+func ClientStreamMiddleware() middleware.ClientStreamMiddleware {
+	return func(handler middleware.ClientStreamHandler) middleware.ClientStreamHandler {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return handler(outgoing(ctx), desc, cc, method, opts...)
+		}
+	}
+}
+
+// ServerMiddleware 把incoming metadata中的路由key放入context，handler中发起的调用沿用相同的路由
+func ServerMiddleware() middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			return handler(incoming(ctx), req)
+		}
+	}
+}
+
+func ServerStreamMiddleware() middleware.StreamMiddleware {
+	return func(handler middleware.StreamHandler) middleware.StreamHandler {
+		return func(srv interface{}, ss grpc.ServerStream) error {
+			stream := middleware.WrapServerStream(ss)
+			stream.Ctx = incoming(ss.Context())
+			return handler(srv, stream)
+		}
+	}
+}
+
+// outgoing 不修改调用方的metadata
+func outgoing(ctx context.Context) context.Context {
+	keys := FromContext(ctx)
+	if keys.IsZero() {
+		return ctx
+	}
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	keys.ToMetadata(md)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// incoming 已经在context中设置的路由key优先
+func incoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	keys := FromMetadata(md)
+	if keys.IsZero() {
+		return ctx
+	}
+	cur := FromContext(ctx)
+	if cur.Group != "" {
+		keys.Group = cur.Group
+	}
+	if cur.Version != "" {
+		keys.Version = cur.Version
+	}
+	if cur.Zone != "" {
+		keys.Zone = cur.Zone
+	}
+	if len(cur.Tags) > 0 {
+		keys.Tags = cur.Tags
+	}
+	for k, v := range cur.Meta {
+		if keys.Meta == nil {
+			keys.Meta = make(map[string]string, len(cur.Meta))
+		}
+		keys.Meta[k] = v
+	}
+	return NewContext(ctx, keys)
+}
@@ -4,6 +4,7 @@ import (
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 	"google.golang.org/grpc/resolver"
+	"micro/loadbalance"
 	"micro/route"
 	"sync/atomic"
 )
@@ -12,26 +13,19 @@ type Balancer struct {
 	connections []*subConn
 	index       int32
 	len         int32
-	filter      route.Filter
+	router      loadbalance.Base
 }
 
 func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	// filter
-	candidates := make([]*subConn, 0, b.len)
-	for _, c := range b.connections {
-		if b.filter != nil && !b.filter(info, c.addr) {
-			continue
-		}
-		candidates = append(candidates, c)
+	candidates, err := b.router.Candidates(info, len(b.connections), b.addr)
+	if err != nil {
+		return balancer.PickResult{}, err
 	}
 
 	// load balancer
-	if len(candidates) == 0 {
-		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
-	}
-
 	idx := atomic.AddInt32(&b.index, 1)
-	conn := candidates[int(idx)%len(candidates)]
+	conn := b.connections[candidates[uint32(idx)%uint32(len(candidates))]]
 
 	return balancer.PickResult{
 		SubConn: conn.conn,
@@ -41,8 +35,17 @@ func (b *Balancer) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	}, nil
 }
 
+func (b *Balancer) addr(i int) resolver.Address {
+	return b.connections[i].addr
+}
+
+// Builder 在符合Filter的节点中轮询
+// 没有节点符合Filter且没有设置Fallback时返回 loadbalance.ErrNoRoute，请求立即以Unavailable失败；
+// 不再返回 balancer.ErrNoSubConnAvailable 让请求一直等待新的picker
 type Builder struct {
 	Filter route.Filter
+	// Fallback 见 loadbalance.Base
+	Fallback route.Filter
 }
 
 func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
@@ -59,7 +62,7 @@ func (b *Builder) Build(info base.PickerBuildInfo) balancer.Picker {
 		connections: connections,
 		index:       -1,
 		len:         int32(len(connections)),
-		filter:      b.Filter,
+		router:      loadbalance.NewBase(b.Filter, b.Fallback),
 	}
 }
 
@@ -0,0 +1,184 @@
+package route
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"micro/demo/grpc/proto"
+	"micro/middleware"
+	"micro/registry"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	ins := &registry.ServiceInstance{
+		Group:   "A",
+		Version: "v2",
+		Zone:    "sh",
+		Tags:    []string{"canary", "ssd"},
+		Meta:    map[string]string{"env": "prod"},
+	}
+	addr := resolver.Address{Addr: "127.0.0.1:8080", Attributes: ins.Attributes()}
+	bare := resolver.Address{Addr: "127.0.0.1:8081"}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		ctx    context.Context
+		want   bool
+		// wantBare 没有attribute的节点
+		wantBare bool
+	}{
+		{name: "no keys", filter: KeysFilter(), ctx: context.Background(), want: true, wantBare: true},
+		{name: "nil ctx", filter: GroupFilter{}.Build(), want: true, wantBare: true},
+		{name: "group", filter: GroupFilter{}.Build(), ctx: WithGroup(context.Background(), "A"), want: true},
+		{name: "other group", filter: GroupFilter{}.Build(), ctx: WithGroup(context.Background(), "B")},
+		{name: "static group", filter: GroupFilter{Group: "A"}.Build(), ctx: WithGroup(context.Background(), "B"), want: true},
+		{name: "version", filter: VersionFilter{}.Build(), ctx: WithVersion(context.Background(), "v2"), want: true},
+		{name: "zone", filter: ZoneFilter{Zone: "bj"}.Build(), ctx: context.Background()},
+		{name: "tags", filter: TagFilter{}.Build(), ctx: WithTags(context.Background(), "ssd", "canary"), want: true},
+		{name: "missing tag", filter: TagFilter{Tags: []string{"ssd", "gpu"}}.Build(), ctx: context.Background()},
+		{name: "meta", filter: MetaFilter{}.Build(), ctx: WithMeta(context.Background(), "env", "prod"), want: true},
+		{name: "other meta", filter: MetaFilter{Meta: map[string]string{"env": "test"}}.Build(), ctx: context.Background()},
+		{
+			name:   "keys",
+			filter: KeysFilter(),
+			ctx:    WithMeta(WithTags(WithZone(WithVersion(WithGroup(context.Background(), "A"), "v2"), "sh"), "canary"), "env", "prod"),
+			want:   true,
+		},
+		{name: "keys mismatch", filter: KeysFilter(), ctx: WithZone(WithGroup(context.Background(), "A"), "bj")},
+		{
+			name:     "or",
+			filter:   Or(GroupFilter{Group: "B"}.Build(), VersionFilter{Version: "v2"}.Build()),
+			ctx:      context.Background(),
+			want:     true,
+			wantBare: false,
+		},
+		{name: "empty or", filter: Or(), ctx: context.Background()},
+		{name: "not", filter: Not(TagFilter{Tags: []string{"canary"}}.Build()), ctx: context.Background(), wantBare: true},
+		{name: "and nil", filter: And(nil, GroupFilter{Group: "A"}.Build()), ctx: context.Background(), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := balancer.PickInfo{Ctx: tt.ctx}
+			assert.Equal(t, tt.want, tt.filter(info, addr))
+			assert.Equal(t, tt.wantBare, tt.filter(info, bare))
+		})
+	}
+}
+
+func TestWithKeys(t *testing.T) {
+	parent := WithMeta(WithTags(context.Background(), "a"), "k", "v")
+	child := WithMeta(WithTags(parent, "b"), "k", "v2")
+	// 不修改上游的key
+	assert.Equal(t, Keys{Tags: []string{"a"}, Meta: map[string]string{"k": "v"}}, FromContext(parent))
+	assert.Equal(t, Keys{Tags: []string{"a", "b"}, Meta: map[string]string{"k": "v2"}}, FromContext(child))
+}
+
+func TestPropagation(t *testing.T) {
+	ctx := WithGroup(context.Background(), "A")
+	ctx = WithTags(ctx, "canary", "ssd")
+	ctx = WithMeta(ctx, "Env", "prod")
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-request-id", "123")
+
+	var downstream Keys
+	server := middleware.BuildServerInterceptor([]middleware.Middleware{ServerMiddleware()})
+	// handler中发起的调用会继续传递路由key
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx = WithVersion(ctx, "v2")
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			downstream = FromMetadata(md)
+			return nil
+		}
+		return nil, ClientMiddleware()(invoker)(ctx, "/order.OrderService/Get", req, nil, nil)
+	}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		assert.Equal(t, []string{"123"}, md.Get("x-request-id"))
+		_, err := server(metadata.NewIncomingContext(context.Background(), md), req, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	err := ClientMiddleware()(invoker)(ctx, "/users.UserService/GetByID", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Keys{
+		Group:   "A",
+		Version: "v2",
+		Tags:    []string{"canary", "ssd"},
+		Meta:    map[string]string{"Env": "prod"},
+	}, downstream)
+
+	// 调用方的metadata没有被修改
+	md, _ := metadata.FromOutgoingContext(ctx)
+	assert.Empty(t, md.Get(HeaderGroup))
+}
+
+func TestMetadata(t *testing.T) {
+	keys := Keys{
+		Group: "A",
+		Tags:  []string{"a,b", "c d", "灰度"},
+		Meta:  map[string]string{"Env": "prod", "k=v,": "x=y,z", "empty": ""},
+	}
+	md := metadata.MD{}
+	keys.ToMetadata(md)
+	// 百分号编码后都是合法的metadata值
+	assert.Equal(t, []string{"a%2Cb,c+d,%E7%81%B0%E5%BA%A6"}, md.Get(HeaderTags))
+	assert.Equal(t, keys, FromMetadata(md))
+
+	// 同名header被拆成多个值
+	md = metadata.Pairs(HeaderTags, "a%2Cb", HeaderTags, "ssd", HeaderMeta, "Env=prod", HeaderMeta, "bad,zone=sh")
+	assert.Equal(t, Keys{
+		Tags: []string{"a,b", "ssd"},
+		Meta: map[string]string{"Env": "prod", "zone": "sh"},
+	}, FromMetadata(md))
+}
+
+func TestMetadataOverGRPC(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	us := &userServer{}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		middleware.BuildServerInterceptor([]middleware.Middleware{ServerMiddleware()})))
+	proto.RegisterUserServiceServer(server, us)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	cc, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure(),
+		grpc.WithChainUnaryInterceptor(middleware.BuildClientInterceptor([]middleware.ClientMiddleware{ClientMiddleware()})))
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+
+	// 非ASCII的值直接放进header会在建立stream时被grpc拒绝
+	keys := Keys{
+		Group:   "A",
+		Version: "v2-灰度",
+		Zone:    "上海",
+		Tags:    []string{"canary"},
+		Meta:    map[string]string{"Env": "生产"},
+	}
+	ctx, cancel := context.WithTimeout(NewContext(context.Background(), keys), time.Second*3)
+	defer cancel()
+	_, err = proto.NewUserServiceClient(cc).GetByID(ctx, &proto.Request{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, keys, us.keys)
+}
+
+type userServer struct {
+	proto.UnimplementedUserServiceServer
+	keys Keys
+}
+
+func (s *userServer) GetByID(ctx context.Context, req *proto.Request) (*proto.Response, error) {
+	s.keys = FromContext(ctx)
+	return &proto.Response{}, nil
+}
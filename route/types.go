@@ -5,16 +5,36 @@ import (
 	"google.golang.org/grpc/resolver"
 )
 
+// Filter 返回节点是否可以被选中
 type Filter func(info balancer.PickInfo, addr resolver.Address) bool
 
-type GroupFilter struct {
-	Croup string
+// And 全部通过才选中节点，nil会被忽略，没有Filter时选中所有节点
+func And(filters ...Filter) Filter {
+	return func(info balancer.PickInfo, addr resolver.Address) bool {
+		for _, f := range filters {
+			if f != nil && !f(info, addr) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or 任意一个通过就选中节点，nil会被忽略，没有Filter时不选中任何节点
+func Or(filters ...Filter) Filter {
+	return func(info balancer.PickInfo, addr resolver.Address) bool {
+		for _, f := range filters {
+			if f != nil && f(info, addr) {
+				return true
+			}
+		}
+		return false
+	}
 }
 
-func (g GroupFilter) Build() Filter {
+// Not 取反，nil表示选中所有节点，取反后不选中任何节点
+func Not(filter Filter) Filter {
 	return func(info balancer.PickInfo, addr resolver.Address) bool {
-		target := addr.Attributes.Value("group").(string)
-		input := info.Ctx.Value("group").(string)
-		return target == input
+		return filter != nil && !filter(info, addr)
 	}
 }
@@ -9,3 +9,9 @@ type Service interface {
 type Proxy interface {
 	Invoke(ctx context.Context, req *Request) (*Response, error)
 }
+
+// HandleFunc 处理一次RPC调用，客户端和服务端的中间件共用
+type HandleFunc func(ctx context.Context, req *Request) (*Response, error)
+
+// Middleware 客户端中间件可以修改 req.Meta，服务端中间件可以用 peer.FromContext 取到调用方地址
+type Middleware func(next HandleFunc) HandleFunc
@@ -3,19 +3,41 @@ package micro
 import (
 	"context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"micro/middleware"
 	"micro/registry"
 	"net"
+	"os"
+	"os/signal"
+	"sync"
 	"time"
 )
 
 type Server struct {
-	name            string
-	registry        registry.Registry
-	registryTimeout time.Duration
-	listener        net.Listener
-	group           string
-	middleware      []middleware.Middleware
+	name             string
+	registry         registry.Registry
+	registryTimeout  time.Duration
+	listener         net.Listener
+	group            string
+	weight           uint32
+	version          string
+	zone             string
+	tags             []string
+	meta             map[string]string
+	middleware       []middleware.Middleware
+	streamMiddleware []middleware.StreamMiddleware
+	health           *health.Server
+
+	// instance 本节点注册的实例，关闭时只摘除自己
+	instance        *registry.ServiceInstance
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
+	signals         []os.Signal
+	closed          chan struct{}
+	closeOnce       sync.Once
+	closeErr        error
+	mutex           sync.Mutex
 	*grpc.Server
 }
 
@@ -26,6 +48,9 @@ func NewServer(name string, opts ...ServerOption) (*Server, error) {
 		name:            name,
 		Server:          grpc.NewServer(),
 		registryTimeout: time.Second * 10,
+		health:          health.NewServer(),
+		shutdownTimeout: time.Second * 30,
+		closed:          make(chan struct{}),
 	}
 
 	// 函数选项
@@ -37,6 +62,9 @@ func NewServer(name string, opts ...ServerOption) (*Server, error) {
 	serverOption := res.middlewareOption()
 	res.Server = grpc.NewServer(serverOption...)
 
+	// 健康检查服务 grpc.health.v1
+	healthpb.RegisterHealthServer(res.Server, res.health)
+
 	return res, nil
 }
 
@@ -45,7 +73,7 @@ func (s *Server) middlewareOption() []grpc.ServerOption {
 		middleware.BuildServerInterceptor(s.middleware),
 	}
 	stream := []grpc.StreamServerInterceptor{
-		// TODO
+		middleware.BuildStreamServerInterceptor(s.streamMiddleware),
 	}
 
 	opts := []grpc.ServerOption{
@@ -63,37 +91,125 @@ func (s *Server) Start(addr string) error {
 	}
 	s.listener = listener
 
+	// 所有已注册的服务标记为可用
+	for service := range s.GetServiceInfo() {
+		s.health.SetServingStatus(service, healthpb.HealthCheckResponse_SERVING)
+	}
+
 	// 有注册中心
 	if s.registry != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), s.registryTimeout)
 		defer cancel()
 
-		err = s.registry.Register(ctx, &registry.ServiceInstance{
+		instance := &registry.ServiceInstance{
 			Name:    s.name,
 			Address: listener.Addr().String(),
 			Group:   s.group,
-		})
+			Weight:  s.weight,
+			Version: s.version,
+			Zone:    s.zone,
+			Tags:    s.tags,
+			Meta:    s.meta,
+		}
+		err = s.registry.Register(ctx, instance)
 		if err != nil {
 			return err
 		}
+		s.mutex.Lock()
+		select {
+		case <-s.closed:
+			// 注册期间已经调用了Close，shutdown看不到该实例，这里摘除
+			s.mutex.Unlock()
+			ctx, cancel := context.WithTimeout(context.Background(), s.registryTimeout)
+			defer cancel()
+			_ = s.registry.UnRegister(ctx, instance)
+			_ = listener.Close()
+			return grpc.ErrServerStopped
+		default:
+		}
+		s.instance = instance
+		s.mutex.Unlock()
+	}
+
+	if len(s.signals) > 0 {
+		go s.handleSignals()
 	}
 
 	// 启动服务
 	return s.Serve(listener)
 }
 
+// Close 优雅退出，可重复调用
+// 1. 从注册中心摘除本节点 2. 健康检查标记为不可用 3. 等待客户端感知
+// 4. GracefulStop，超过shutdownTimeout后强制Stop
+// 不会关闭注册中心，注册中心（如etcd）由调用方自行Close
 func (s *Server) Close() error {
-	if s.registry != nil {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.closeErr = s.shutdown()
+	})
+	return s.closeErr
+}
+
+func (s *Server) shutdown() error {
+	s.mutex.Lock()
+	instance := s.instance
+	s.mutex.Unlock()
+
+	var err error
+	if s.registry != nil && instance != nil {
 		// 服务有注册中心，先从注册中心将服务摘掉
-		err := s.registry.Close()
-		if err != nil {
-			return err
-		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.registryTimeout)
+		err = s.registry.UnRegister(ctx, instance)
+		cancel()
+	}
+
+	// 所有服务标记为不可用，开启健康检查的客户端会摘掉该节点
+	s.health.Shutdown()
+
+	// 等待客户端感知节点下线
+	if s.drainDelay > 0 {
+		time.Sleep(s.drainDelay)
 	}
 
 	// 关闭服务
-	s.GracefulStop()
-	return nil
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	if s.shutdownTimeout <= 0 {
+		<-stopped
+		return err
+	}
+
+	timer := time.NewTimer(s.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		// 还有未完成的请求，强制关闭
+		s.Stop()
+		<-stopped
+	}
+	return err
+}
+
+func (s *Server) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, s.signals...)
+	defer signal.Stop(ch)
+
+	select {
+	case <-ch:
+		_ = s.Close()
+	case <-s.closed:
+	}
+}
+
+// SetServingStatus 设置单个服务的健康状态，service为空表示整个服务端
+func (s *Server) SetServingStatus(service string, status healthpb.HealthCheckResponse_ServingStatus) {
+	s.health.SetServingStatus(service, status)
 }
 
 // ServerWithRegister 配置注册中心
@@ -109,8 +225,71 @@ func ServerWithGroup(group string) ServerOption {
 	}
 }
 
+// ServerWithWeight 实例权重，供加权负载均衡使用
+func ServerWithWeight(weight uint32) ServerOption {
+	return func(server *Server) {
+		server.weight = weight
+	}
+}
+
+func ServerWithVersion(version string) ServerOption {
+	return func(server *Server) {
+		server.version = version
+	}
+}
+
+func ServerWithZone(zone string) ServerOption {
+	return func(server *Server) {
+		server.zone = zone
+	}
+}
+
+func ServerWithTags(tags ...string) ServerOption {
+	return func(server *Server) {
+		server.tags = append(server.tags, tags...)
+	}
+}
+
+// ServerWithMeta 自定义元数据，可多次调用
+func ServerWithMeta(key, value string) ServerOption {
+	return func(server *Server) {
+		if server.meta == nil {
+			server.meta = make(map[string]string, 4)
+		}
+		server.meta[key] = value
+	}
+}
+
+// ServerWithDrainDelay 摘除节点后等待客户端感知的时间
+func ServerWithDrainDelay(delay time.Duration) ServerOption {
+	return func(server *Server) {
+		server.drainDelay = delay
+	}
+}
+
+// ServerWithShutdownTimeout GracefulStop的最长等待时间，超时后强制关闭，<=0 表示一直等待
+func ServerWithShutdownTimeout(timeout time.Duration) ServerOption {
+	return func(server *Server) {
+		server.shutdownTimeout = timeout
+	}
+}
+
+// ServerWithSignal 收到信号时自动调用Close，如 syscall.SIGTERM, syscall.SIGINT
+func ServerWithSignal(signals ...os.Signal) ServerOption {
+	return func(server *Server) {
+		server.signals = append(server.signals, signals...)
+	}
+}
+
 func ServerWithMiddleware(middleware middleware.Middleware) ServerOption {
 	return func(server *Server) {
 		server.middleware = append(server.middleware, middleware)
 	}
 }
+
+// ServerWithStreamMiddleware 流式调用的中间件，按添加顺序执行
+func ServerWithStreamMiddleware(middleware middleware.StreamMiddleware) ServerOption {
+	return func(server *Server) {
+		server.streamMiddleware = append(server.streamMiddleware, middleware)
+	}
+}
@@ -0,0 +1,138 @@
+package micro
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"micro/demo/grpc/proto"
+	"micro/registry"
+	"micro/registry/memory"
+	"testing"
+	"time"
+)
+
+func TestServer_Close(t *testing.T) {
+	r := memory.NewRegistry()
+	defer func() {
+		_ = r.Close()
+	}()
+	ctx := context.Background()
+
+	// 同一个注册中心上的其他节点
+	other := &registry.ServiceInstance{Name: "user-service", Address: "127.0.0.1:9999"}
+	require.NoError(t, r.Register(ctx, other))
+
+	blocking := &blockingServer{started: make(chan struct{})}
+	server, err := NewServer("user-service",
+		ServerWithRegister(r),
+		ServerWithDrainDelay(200*time.Millisecond),
+		ServerWithShutdownTimeout(100*time.Millisecond),
+	)
+	require.NoError(t, err)
+	proto.RegisterUserServiceServer(server, blocking)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Start("127.0.0.1:0")
+	}()
+	require.Eventually(t, func() bool {
+		instances, er := r.ListServices(ctx, "user-service")
+		return er == nil && len(instances) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	cc, err := grpc.Dial(server.listener.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer func() {
+		_ = cc.Close()
+	}()
+	hc := healthpb.NewHealthClient(cc)
+	resp, err := hc.Check(ctx, &healthpb.HealthCheckRequest{Service: "users.UserService"})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	// 一直不返回的请求
+	go func() {
+		_, _ = proto.NewUserServiceClient(cc).GetByID(ctx, &proto.Request{Id: 123})
+	}()
+	<-blocking.started
+
+	closed := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		closed <- server.Close()
+	}()
+
+	// 等待期间：只摘除本节点，健康检查返回NOT_SERVING
+	require.Eventually(t, func() bool {
+		instances, er := r.ListServices(ctx, "user-service")
+		return er == nil && len(instances) == 1 && instances[0].Address == other.Address
+	}, 100*time.Millisecond, 5*time.Millisecond)
+	resp, err = hc.Check(ctx, &healthpb.HealthCheckRequest{Service: "users.UserService"})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+
+	// 超时后强制关闭
+	select {
+	case err = <-closed:
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	case <-time.After(2 * time.Second):
+		t.Fatal("关闭超时")
+	}
+	require.NoError(t, <-served)
+
+	// 重复关闭
+	assert.NoError(t, server.Close())
+}
+
+type blockingServer struct {
+	started chan struct{}
+	proto.UnimplementedUserServiceServer
+}
+
+func (s *blockingServer) GetByID(ctx context.Context, request *proto.Request) (*proto.Response, error) {
+	close(s.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// slowRegistry 注册时阻塞，直到测试放行
+type slowRegistry struct {
+	*memory.Registry
+	registering chan struct{}
+	release     chan struct{}
+}
+
+func (r *slowRegistry) Register(ctx context.Context, si *registry.ServiceInstance) error {
+	close(r.registering)
+	<-r.release
+	return r.Registry.Register(ctx, si)
+}
+
+func TestServer_CloseWhileRegistering(t *testing.T) {
+	r := &slowRegistry{
+		Registry:    memory.NewRegistry(),
+		registering: make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	server, err := NewServer("user-service", ServerWithRegister(r))
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Start("127.0.0.1:0")
+	}()
+	<-r.registering
+	require.NoError(t, server.Close())
+	close(r.release)
+
+	// 注册完成后发现已关闭，立即摘除
+	assert.Equal(t, grpc.ErrServerStopped, <-served)
+	instances, err := r.ListServices(context.Background(), "user-service")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+}